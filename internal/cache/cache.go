@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Cache is a persistent on-disk cache of repository index files and chart archives.
+//
+// Layout:
+//
+//	index/<sha256 of repository URL>/index.yaml
+//	index/<sha256 of repository URL>/meta.json
+//	charts/sha256/<hex digest>/<chart archive file name>
+//	charts/sha256/<hex digest>/<chart archive file name>.prov
+//	refs/<sha256 of chart reference>
+//	tags/<sha256 of OCI chart reference>.json
+type Cache struct {
+	path string
+}
+
+// IndexMeta is the information needed to revalidate a cached index file.
+type IndexMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+func New(path string) (*Cache, error) {
+	err := os.MkdirAll(path, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cache folder: %w", err)
+	}
+	return &Cache{path: path}, nil
+}
+
+// DefaultPath returns the default cache folder, inside the user cache folder (XDG_CACHE_HOME on Linux).
+func DefaultPath() (string, error) {
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userCacheDir, "helm-vendor"), nil
+}
+
+func (c *Cache) Path() string {
+	return c.path
+}
+
+// Index returns the cached index file name for the repository URL, and its revalidation information.
+func (c *Cache) Index(repoURL string) (string, IndexMeta, bool) {
+	dir := filepath.Join(c.path, "index", keyHash(repoURL))
+	indexFilename := filepath.Join(dir, "index.yaml")
+	if _, err := os.Stat(indexFilename); err != nil {
+		return "", IndexMeta{}, false
+	}
+	var meta IndexMeta
+	metaData, err := os.ReadFile(filepath.Join(dir, "meta.json"))
+	if err == nil {
+		_ = json.Unmarshal(metaData, &meta)
+	}
+	return indexFilename, meta, true
+}
+
+// StoreIndex stores the index file data for the repository URL, returning the cached file name.
+func (c *Cache) StoreIndex(repoURL string, data []byte, meta IndexMeta) (string, error) {
+	dir := filepath.Join(c.path, "index", keyHash(repoURL))
+	meta.URL = repoURL
+	metaData, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+	indexFilename := filepath.Join(dir, "index.yaml")
+	if err := writeFileAtomic(indexFilename, data); err != nil {
+		return "", fmt.Errorf("error storing index file in cache: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "meta.json"), metaData); err != nil {
+		return "", fmt.Errorf("error storing index file in cache: %w", err)
+	}
+	return indexFilename, nil
+}
+
+// Chart returns the cached chart archive file name with the digest, in the "sha256:<hex>" format.
+func (c *Cache) Chart(digest string) (string, bool) {
+	chartPath, err := c.chartPath(digest)
+	if err != nil {
+		return "", false
+	}
+	entries, err := os.ReadDir(chartPath)
+	if err != nil {
+		return "", false
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") &&
+			!strings.HasSuffix(entry.Name(), ".prov") {
+			return filepath.Join(chartPath, entry.Name()), true
+		}
+	}
+	return "", false
+}
+
+// StoreChart copies the chart archive file to the cache, keyed by its digest in the "sha256:<hex>" format. The
+// file name is kept, as it is checked when verifying the provenance file.
+func (c *Cache) StoreChart(filename string, digest string) error {
+	if _, ok := c.Chart(digest); ok {
+		return nil
+	}
+	chartPath, err := c.chartPath(digest)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(chartPath, filepath.Base(filename)), data); err != nil {
+		return fmt.Errorf("error storing chart in cache: %w", err)
+	}
+	return nil
+}
+
+// StoreProvenance copies the chart provenance file to the cache, next to the chart archive with the digest.
+func (c *Cache) StoreProvenance(filename string, digest string) error {
+	chartPath, err := c.chartPath(digest)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(chartPath, filepath.Base(filename)), data); err != nil {
+		return fmt.Errorf("error storing chart provenance in cache: %w", err)
+	}
+	return nil
+}
+
+// ChartRef returns the digest of the chart archive last downloaded from the reference.
+func (c *Cache) ChartRef(ref string) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(c.path, "refs", keyHash(ref)))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
+}
+
+// StoreChartRef records the digest of the chart archive downloaded from the reference.
+func (c *Cache) StoreChartRef(ref string, digest string) error {
+	err := writeFileAtomic(filepath.Join(c.path, "refs", keyHash(ref)), []byte(digest+"\n"))
+	if err != nil {
+		return fmt.Errorf("error storing chart reference in cache: %w", err)
+	}
+	return nil
+}
+
+// Tags returns the cached tag list of the OCI chart reference.
+func (c *Cache) Tags(ref string) ([]string, bool) {
+	data, err := os.ReadFile(filepath.Join(c.path, "tags", keyHash(ref)+".json"))
+	if err != nil {
+		return nil, false
+	}
+	var tags []string
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return nil, false
+	}
+	return tags, true
+}
+
+// StoreTags stores the tag list of the OCI chart reference.
+func (c *Cache) StoreTags(ref string, tags []string) error {
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(filepath.Join(c.path, "tags", keyHash(ref)+".json"), data)
+	if err != nil {
+		return fmt.Errorf("error storing chart tags in cache: %w", err)
+	}
+	return nil
+}
+
+func (c *Cache) chartPath(digest string) (string, error) {
+	algorithm, hash, ok := strings.Cut(digest, ":")
+	if !ok || algorithm != "sha256" || hash == "" || strings.ContainsAny(hash, `/\.`) {
+		return "", fmt.Errorf("invalid chart digest '%s'", digest)
+	}
+	return filepath.Join(c.path, "charts", algorithm, hash), nil
+}
+
+func keyHash(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// writeFileAtomic writes the file to a temporary file in the same folder and renames it, so concurrent readers
+// never see a partial file.
+func writeFileAtomic(filename string, data []byte) error {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
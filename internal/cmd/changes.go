@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rrgmc/helm-vendor/internal/config"
+	"github.com/rrgmc/helm-vendor/internal/diff"
+	"github.com/rrgmc/helm-vendor/internal/file"
+	"github.com/rrgmc/helm-vendor/internal/helm"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+type ChangesOptions struct {
+	// Summary lists the added, removed and changed files, instead of the diff.
+	Summary bool
+	// Color adds terminal colors to the diff.
+	Color bool
+	// Policy restricts the newer versions considered when no target version is passed.
+	Policy VersionPolicy
+}
+
+// upstreamChanges is the diff between two upstream versions of a chart.
+type upstreamChanges struct {
+	fromChart, toChart *repo.ChartVersion
+	diff               *diff.Builder
+	added              []string
+	removed            []string
+	changed            []string
+}
+
+// Changes prints the unified diff of the upstream chart files between two versions. The default from version is the
+// local version, and the default to version is the latest one allowed by the policy, as used by upgrade.
+func (c *Cmd) Changes(ctx context.Context, path string, fromVersion, toVersion string, options ChangesOptions) error {
+	for _, chartConfig := range c.cfg.Charts {
+		if path == chartConfig.Path {
+			changes, err := c.chartUpstreamChanges(ctx, chartConfig, fromVersion, toVersion, options.Policy)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+
+			switch {
+			case options.Summary:
+				changes.print(os.Stdout, chartConfig)
+			case options.Color:
+				fmt.Print(diff.Color(changes.diff.String()))
+			default:
+				_, _ = os.Stdout.Write(changes.diff.Bytes())
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown path '%s'", path)
+}
+
+func (c *Cmd) chartUpstreamChanges(ctx context.Context, chartConfig config.Chart, fromVersion, toVersion string,
+	policy VersionPolicy) (*upstreamChanges, error) {
+	repository, err := c.loadRepository(ctx, chartConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var currentChart *repo.ChartVersion
+	if c.chartRootExists(chartConfig) {
+		chartRoot, err := c.openChartRoot(chartConfig)
+		if err != nil {
+			return nil, err
+		}
+		currentChart, err = c.currentChartVersion(chartConfig, chartRoot)
+		_ = chartRoot.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error loading current chart version: %w", err)
+		}
+	}
+
+	var fromChart *helm.Chart
+	if fromVersion == "" {
+		if currentChart == nil {
+			return nil, fmt.Errorf("chart not found in path '%s', the from version is required", chartConfig.Path)
+		}
+		fromChart, err = repository.GetLockedChart(chartConfig.Name, currentChart.Version, currentChart.Digest)
+	} else {
+		fromChart, err = repository.GetChart(chartConfig.Name, fromVersion)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	toChart, err := c.resolveChart(repository, chartConfig, toVersion, currentChart, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	fromChartFiles, err := fromChart.Download(c.chartDownloadOptions(ctx, chartConfig)...)
+	if err != nil {
+		return nil, err
+	}
+	defer fromChartFiles.Close()
+
+	toChartFiles, err := toChart.Download(c.chartDownloadOptions(ctx, chartConfig)...)
+	if err != nil {
+		return nil, err
+	}
+	defer toChartFiles.Close()
+
+	chartFileIter := func(iter file.Iter) file.Iter {
+		return file.IterFilter(iter, file.Filter{
+			Ignore: chartConfig.Files.Ignore,
+		})
+	}
+
+	return newUpstreamChanges(fromChartFiles, toChartFiles, chartFileIter)
+}
+
+func newUpstreamChanges(fromChartFiles, toChartFiles *helm.ChartFiles,
+	chartFileIter func(iter file.Iter) file.Iter) (*upstreamChanges, error) {
+	changes := &upstreamChanges{
+		fromChart: fromChartFiles.Chart().Chart(),
+		toChart:   toChartFiles.Chart().Chart(),
+		diff:      diff.NewBuilder(true),
+	}
+
+	toFiles := map[string]bool{}
+	for fi, err := range chartFileIter(toChartFiles.Iter()) {
+		if err != nil {
+			return nil, err
+		}
+		if !fi.Entry.IsDir() {
+			toFiles[fi.Path] = true
+		}
+	}
+
+	fromFiles := map[string]bool{}
+	for fi, err := range chartFileIter(fromChartFiles.Iter()) {
+		if err != nil {
+			return nil, err
+		}
+		if fi.Entry.IsDir() {
+			continue
+		}
+		fromFiles[fi.Path] = true
+
+		if !toFiles[fi.Path] {
+			changes.removed = append(changes.removed, fi.Path)
+		}
+
+		statCount := len(changes.diff.Stats())
+		err = changes.diff.Add(fi.Path, fi.Path, fromChartFiles.Root(), toChartFiles.Root(), fi.Path, fi.Path)
+		if err != nil {
+			return nil, err
+		}
+		if toFiles[fi.Path] && len(changes.diff.Stats()) > statCount {
+			changes.changed = append(changes.changed, fi.Path)
+		}
+	}
+
+	for fi, err := range chartFileIter(toChartFiles.Iter()) {
+		if err != nil {
+			return nil, err
+		}
+		if fi.Entry.IsDir() || fromFiles[fi.Path] {
+			continue
+		}
+		changes.added = append(changes.added, fi.Path)
+
+		err = changes.diff.AddLocal(fi.Path, toChartFiles.Root(), fi.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+func (u *upstreamChanges) print(out io.Writer, chartConfig config.Chart) {
+	_, _ = fmt.Fprintf(out, "Changes of '%s' [%s => %s]:\n", chartConfig.Path, helm.GetChartVersion(u.fromChart),
+		helm.GetChartVersion(u.toChart))
+
+	printList := func(title string, list []string) {
+		_, _ = fmt.Fprintf(out, "- %s: %d\n", title, len(list))
+		for _, item := range list {
+			_, _ = fmt.Fprintf(out, "\t- %s\n", item)
+		}
+	}
+
+	printList("added", u.added)
+	printList("removed", u.removed)
+	printList("changed", u.changed)
+}
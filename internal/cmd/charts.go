@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+
+	"github.com/rrgmc/helm-vendor/internal/config"
+)
+
+// chartFunc processes a chart, writing its output to out.
+type chartFunc func(ctx context.Context, index int, chartConfig config.Chart, out io.Writer) error
+
+// forEachChart calls fn for each chart, processing up to the configured concurrency at the same time. The output of
+// each chart is buffered and written to stdout in the charts order. Charts not yet started when the context is
+// cancelled are not processed, and return the context error. Returns the error of each chart, in the charts order.
+func (c *Cmd) forEachChart(ctx context.Context, charts []config.Chart, fn chartFunc) []error {
+	type chartResult struct {
+		out  bytes.Buffer
+		err  error
+		done chan struct{}
+	}
+
+	sem := make(chan struct{}, max(c.concurrency, 1))
+
+	results := make([]*chartResult, len(charts))
+	for i, chartConfig := range charts {
+		result := &chartResult{done: make(chan struct{})}
+		results[i] = result
+
+		go func() {
+			defer close(result.done)
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				result.err = ctx.Err()
+				return
+			}
+			if err := ctx.Err(); err != nil {
+				result.err = err
+				return
+			}
+
+			result.err = fn(ctx, i, chartConfig, &result.out)
+		}()
+	}
+
+	errs := make([]error, len(charts))
+	for i, result := range results {
+		<-result.done
+		_, _ = os.Stdout.Write(result.out.Bytes())
+		errs[i] = result.err
+	}
+	return errs
+}
@@ -1,27 +1,56 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 
+	"github.com/rrgmc/helm-vendor/internal/cache"
 	"github.com/rrgmc/helm-vendor/internal/config"
 	"github.com/rrgmc/helm-vendor/internal/file"
+	"github.com/rrgmc/helm-vendor/internal/helm"
+	"github.com/rrgmc/helm-vendor/internal/lock"
 )
 
 type Cmd struct {
-	cfg            config.Config
-	outputRootPath string
-	outputRoot     *os.Root
+	cfg               config.Config
+	rootPath          string
+	outputRootPath    string
+	outputRoot        *os.Root
+	lockFile          string
+	lock              *lock.Lock
+	lockMu            sync.Mutex
+	cache             *cache.Cache
+	offline           bool
+	concurrency       int
+	output            OutputFormat
+	includePrerelease bool
+	repositories      map[string]*repositoryLoad
+	repositoriesMu    sync.Mutex
+}
+
+// repositoryLoad loads a repository only once, even if requested concurrently.
+type repositoryLoad struct {
+	once       sync.Once
+	repository *helm.Repository
+	err        error
 }
 
 func New(cfg config.Config, options ...Option) (*Cmd, error) {
 	ret := &Cmd{
-		cfg: cfg,
+		cfg:          cfg,
+		concurrency:  1,
+		output:       OutputFormatTable,
+		repositories: map[string]*repositoryLoad{},
 	}
 	for _, option := range options {
 		option(ret)
 	}
+	// paths in the config file are relative to the root path
+	ret.rootPath = ret.outputRootPath
 	if cfg.OutputPath != "" {
 		ret.outputRootPath = filepath.Join(ret.outputRootPath, cfg.OutputPath)
 	}
@@ -29,6 +58,14 @@ func New(cfg config.Config, options ...Option) (*Cmd, error) {
 	_ = os.MkdirAll(ret.outputRootPath, os.ModePerm)
 
 	var err error
+	ret.lock = &lock.Lock{}
+	if ret.lockFile != "" {
+		ret.lock, err = lock.LoadFromFile(ret.lockFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load lock file: %w", err)
+		}
+	}
+
 	ret.outputRoot, err = os.OpenRoot(ret.outputRootPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open output path: %w", err)
@@ -37,6 +74,11 @@ func New(cfg config.Config, options ...Option) (*Cmd, error) {
 }
 
 func (c *Cmd) Close() {
+	for _, load := range c.repositories {
+		if load.repository != nil {
+			_ = load.repository.Close()
+		}
+	}
 	_ = c.outputRoot.Close()
 }
 
@@ -45,6 +87,8 @@ func NewFromFile(configFile string, options ...Option) (*Cmd, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	// the lock file is stored next to the config file, "helm-vendor.yaml" => "helm-vendor.lock".
+	options = append([]Option{WithLockFile(file.WithoutExt(configFile) + ".lock")}, options...)
 	return New(cfg, options...)
 }
 
@@ -54,8 +98,157 @@ func WithOutputRoot(outputRoot string) Option {
 	}
 }
 
+func WithLockFile(lockFile string) Option {
+	return func(cmd *Cmd) {
+		cmd.lockFile = lockFile
+	}
+}
+
+// WithCache stores repository index files and chart archives in the cache.
+func WithCache(cache *cache.Cache) Option {
+	return func(cmd *Cmd) {
+		cmd.cache = cache
+	}
+}
+
+// WithOffline serves repository index files and chart archives only from the cache, never accessing the network.
+func WithOffline() Option {
+	return func(cmd *Cmd) {
+		cmd.offline = true
+	}
+}
+
+// WithConcurrency sets the maximum number of charts processed concurrently by the commands which process all charts.
+func WithConcurrency(concurrency int) Option {
+	return func(cmd *Cmd) {
+		cmd.concurrency = max(concurrency, 1)
+	}
+}
+
+// WithOutput sets the output format of the commands which support machine-readable output.
+func WithOutput(output OutputFormat) Option {
+	return func(cmd *Cmd) {
+		cmd.output = output
+	}
+}
+
+// WithIncludePrerelease allows pre-release versions to be used as the latest version for all charts.
+func WithIncludePrerelease() Option {
+	return func(cmd *Cmd) {
+		cmd.includePrerelease = true
+	}
+}
+
 type Option func(*Cmd)
 
+// loadRepository loads the chart repository, using the configured credentials. Repositories are loaded only once
+// and shared between charts with the same repository configuration.
+func (c *Cmd) loadRepository(ctx context.Context, chartConfig config.Chart) (*helm.Repository, error) {
+	repoKey := fmt.Sprintf("%#v", chartConfig.Repository)
+
+	c.repositoriesMu.Lock()
+	load, ok := c.repositories[repoKey]
+	if !ok {
+		load = &repositoryLoad{}
+		c.repositories[repoKey] = load
+	}
+	c.repositoriesMu.Unlock()
+
+	load.once.Do(func() {
+		load.repository, load.err = c.newRepository(ctx, chartConfig.Repository)
+	})
+	return load.repository, load.err
+}
+
+func (c *Cmd) newRepository(ctx context.Context, repoConfig config.Repository) (*helm.Repository, error) {
+	auth := helm.RepositoryAuth{
+		CertFile:              config.ResolvePath(c.rootPath, repoConfig.TLS.CertFile),
+		KeyFile:               config.ResolvePath(c.rootPath, repoConfig.TLS.KeyFile),
+		CAFile:                config.ResolvePath(c.rootPath, repoConfig.TLS.CAFile),
+		InsecureSkipTLSVerify: repoConfig.TLS.InsecureSkipVerify,
+		PlainHTTP:             repoConfig.PlainHTTP,
+	}
+
+	var err error
+	for _, value := range []struct {
+		name   string
+		value  config.Value
+		target *string
+	}{
+		{"username", repoConfig.Username, &auth.Username},
+		{"password", repoConfig.Password, &auth.Password},
+		{"token", repoConfig.Token, &auth.Token},
+	} {
+		*value.target, err = value.value.Resolve(c.rootPath)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving repository %s: %w", value.name, err)
+		}
+	}
+
+	repoURL := repoConfig.URL
+
+	if repoConfig.Name != "" {
+		// use the URL and credentials from Helm's repositories file, if not set in the config.
+		entry, err := helm.FindRepositoryEntry(repoConfig.Name)
+		if err != nil {
+			return nil, err
+		}
+		if repoURL == "" {
+			repoURL = entry.URL
+		}
+		for _, value := range []struct {
+			value  string
+			target *string
+		}{
+			{entry.Username, &auth.Username},
+			{entry.Password, &auth.Password},
+			{entry.CertFile, &auth.CertFile},
+			{entry.KeyFile, &auth.KeyFile},
+			{entry.CAFile, &auth.CAFile},
+		} {
+			if *value.target == "" {
+				*value.target = value.value
+			}
+		}
+		auth.InsecureSkipTLSVerify = auth.InsecureSkipTLSVerify || entry.InsecureSkipTLSverify
+	}
+
+	options := []helm.RepositoryOption{helm.WithRepositoryAuth(auth)}
+	if c.cache != nil {
+		options = append(options, helm.WithRepositoryCache(c.cache))
+	}
+	if c.offline {
+		options = append(options, helm.WithRepositoryOffline())
+	}
+
+	if repoConfig.Git.URL != "" {
+		// relative paths are resolved from the configuration file folder
+		return helm.LoadGitRepository(ctx, helm.GitSource{
+			URL:        repoConfig.Git.URL,
+			FetchURL:   resolveGitURL(c.rootPath, repoConfig.Git.URL),
+			Ref:        repoConfig.Git.Ref,
+			TagPattern: repoConfig.Git.TagPattern,
+			Path:       repoConfig.Git.Path,
+		}, options...)
+	}
+
+	if helm.IsLocalURL(repoURL) {
+		// relative paths are resolved from the configuration file folder
+		return helm.LoadLocalRepository(repoURL, config.ResolvePath(c.rootPath, helm.LocalURLPath(repoURL)), options...)
+	}
+
+	return helm.LoadRepository(ctx, repoURL, options...)
+}
+
+// chartDownloadOptions returns the download options of the chart, like provenance verification.
+func (c *Cmd) chartDownloadOptions(ctx context.Context, chartConfig config.Chart) []helm.ChartDownloadOption {
+	options := []helm.ChartDownloadOption{helm.WithChartDownloadContext(ctx)}
+	if chartConfig.Verify {
+		options = append(options, helm.WithChartVerify(config.ResolvePath(c.rootPath, chartConfig.Keyring)))
+	}
+	return options
+}
+
 func (c *Cmd) openChartRoot(chartConfig config.Chart) (*os.Root, error) {
 	r, err := c.outputRoot.OpenRoot(filepath.Clean(chartConfig.Path))
 	if err != nil {
@@ -75,3 +268,86 @@ func (c *Cmd) createChartRoot(chartConfig config.Chart) error {
 func (c *Cmd) chartRootFileExists(chartConfig config.Chart) bool {
 	return file.Exists(c.outputRoot, filepath.Join(filepath.Clean(chartConfig.Path), "Chart.yaml"))
 }
+
+// stageChartRoot copies the chart root to a sibling staging folder and calls fn with it. The staging folder is
+// swapped with the chart root only if fn succeeds, otherwise it is deleted and the chart root is left untouched.
+func (c *Cmd) stageChartRoot(chartConfig config.Chart, fn func(stagingRoot *os.Root) error) error {
+	chartPath := filepath.Clean(chartConfig.Path)
+	stagingPath := chartPath + ".helm-vendor-staging"
+	backupPath := chartPath + ".helm-vendor-backup"
+
+	// a backup folder is left only if restoring it failed, and may be the only copy of the original files.
+	if file.Exists(c.outputRoot, backupPath) {
+		return fmt.Errorf("backup folder '%s' from a failed upgrade exists, restore the chart folder from it or remove it",
+			backupPath)
+	}
+
+	// remove leftovers from an interrupted upgrade
+	_ = c.outputRoot.RemoveAll(stagingPath)
+
+	err := c.outputRoot.MkdirAll(stagingPath, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("error creating staging folder: %w", err)
+	}
+
+	err = func() error {
+		chartRoot, err := c.openChartRoot(chartConfig)
+		if err != nil {
+			return err
+		}
+		defer chartRoot.Close()
+
+		stagingRoot, err := c.outputRoot.OpenRoot(stagingPath)
+		if err != nil {
+			return fmt.Errorf("failed to open staging path: %w", err)
+		}
+		defer stagingRoot.Close()
+
+		err = file.CopyTree(chartRoot, stagingRoot)
+		if err != nil {
+			return fmt.Errorf("error copying chart files to staging folder: %w", err)
+		}
+
+		return fn(stagingRoot)
+	}()
+	if err != nil {
+		_ = c.outputRoot.RemoveAll(stagingPath)
+		return err
+	}
+
+	// swap the staging folder with the chart root
+	err = c.outputRoot.Rename(chartPath, backupPath)
+	if err != nil {
+		_ = c.outputRoot.RemoveAll(stagingPath)
+		return fmt.Errorf("error moving chart folder to backup: %w", err)
+	}
+
+	err = c.outputRoot.Rename(stagingPath, chartPath)
+	if err != nil {
+		if rerr := c.outputRoot.Rename(backupPath, chartPath); rerr != nil {
+			return fmt.Errorf("error moving staging folder to chart folder: %w (could not restore backup, original files are in '%s': %w)",
+				err, backupPath, rerr)
+		}
+		_ = c.outputRoot.RemoveAll(stagingPath)
+		return fmt.Errorf("error moving staging folder to chart folder: %w", err)
+	}
+
+	_ = c.outputRoot.RemoveAll(backupPath)
+	return nil
+}
+
+// resolveGitURL resolves a git URL which is a relative local path, or a "file://" URL of a relative path, from the
+// basePath folder. Other URLs are returned unchanged.
+func resolveGitURL(basePath string, gitURL string) string {
+	if p, ok := strings.CutPrefix(gitURL, "file://"); ok {
+		return "file://" + config.ResolvePath(basePath, p)
+	}
+	if filepath.IsAbs(gitURL) || strings.Contains(gitURL, "://") {
+		return gitURL
+	}
+	// scp-like syntax, like "git@github.com:org/repo.git"
+	if host, _, ok := strings.Cut(gitURL, ":"); ok && !strings.Contains(host, "/") {
+		return gitURL
+	}
+	return config.ResolvePath(basePath, gitURL)
+}
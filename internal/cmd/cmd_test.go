@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrgmc/helm-vendor/internal/config"
+)
+
+func TestResolveGitURL(t *testing.T) {
+	tests := []struct {
+		gitURL string
+		want   string
+	}{
+		{"https://github.com/org/repo.git", "https://github.com/org/repo.git"},
+		{"ssh://git@github.com/org/repo.git", "ssh://git@github.com/org/repo.git"},
+		{"git@github.com:org/repo.git", "git@github.com:org/repo.git"},
+		{"/srv/git/repo.git", "/srv/git/repo.git"},
+		{"../repo.git", "/work/repo.git"},
+		{"charts/repo", "/work/config/charts/repo"},
+		{"file:///srv/git/repo.git", "file:///srv/git/repo.git"},
+		{"file://charts/repo", "file:///work/config/charts/repo"},
+	}
+	for _, tt := range tests {
+		if got := resolveGitURL("/work/config", tt.gitURL); got != tt.want {
+			t.Errorf("resolveGitURL(%q) = %q, want %q", tt.gitURL, got, tt.want)
+		}
+	}
+}
+
+func TestStageChartRootBackupExists(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"demo/Chart.yaml":                    "name: demo\n",
+		"demo.helm-vendor-backup/Chart.yaml": "name: original\n",
+	} {
+		err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	outputRoot, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outputRoot.Close()
+
+	c := &Cmd{outputRoot: outputRoot}
+	called := false
+	err = c.stageChartRoot(config.Chart{Path: "demo"}, func(stagingRoot *os.Root) error {
+		called = true
+		return nil
+	})
+	if err == nil {
+		t.Fatal("stageChartRoot() succeeded with a leftover backup folder")
+	}
+	if called {
+		t.Error("stageChartRoot() staged the chart with a leftover backup folder")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "demo.helm-vendor-backup", "Chart.yaml"))
+	if err != nil || string(data) != "name: original\n" {
+		t.Errorf("backup folder was changed: %q, %v", data, err)
+	}
+}
@@ -3,13 +3,16 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/rrgmc/helm-vendor/internal/helm"
 )
 
+// Dependency prints the information of the dependencies of the chart in path, and writes the chart files or the
+// values file of the named dependency if requested. The repository options set the cache and the offline mode.
 func Dependency(ctx context.Context, path string, name string, version string, allVersions bool, outputValuesFile bool,
-	outputPath string) error {
+	outputPath string, output OutputFormat, options ...helm.RepositoryOption) error {
 	currentChartFilename := filepath.Join(path, "Chart.yaml")
 
 	chart, err := helm.LoadHelmChartVersionFilename(currentChartFilename)
@@ -17,6 +20,8 @@ func Dependency(ctx context.Context, path string, name string, version string, a
 		return fmt.Errorf("error loading chart file %s: %w\n", currentChartFilename, err)
 	}
 
+	var infos []ChartInfo
+
 	for _, dependency := range chart.Dependencies {
 		isName := dependency.Name == name || dependency.Alias == name
 		if name != "" && !isName {
@@ -38,11 +43,16 @@ func Dependency(ctx context.Context, path string, name string, version string, a
 			continue
 		}
 
-		err = Download(ctx, dependency.Repository, dependency.Name, currentVersion, allVersions, currentOutputValuesFile, currentOutputPath)
+		info, err := downloadChart(ctx, dependency.Repository, dependency.Name, currentVersion, allVersions,
+			currentOutputValuesFile, currentOutputPath, output, options...)
 		if err != nil {
 			return err
 		}
+		infos = append(infos, info)
 	}
 
+	if output != OutputFormatTable {
+		return writeOutput(os.Stdout, output, infos)
+	}
 	return nil
 }
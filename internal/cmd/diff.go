@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rrgmc/helm-vendor/internal/config"
+	"github.com/rrgmc/helm-vendor/internal/diff"
+	"github.com/rrgmc/helm-vendor/internal/file"
+	"github.com/rrgmc/helm-vendor/internal/helm"
+)
+
+type DiffOptions struct {
+	// Stat prints the number of lines added and deleted in each file, instead of the diff.
+	Stat bool
+	// NameOnly prints only the names of the changed files, instead of the diff.
+	NameOnly bool
+	// Color adds terminal colors to the output.
+	Color bool
+	// OutputFile writes the output to this file instead of the standard output.
+	OutputFile string
+}
+
+// Diff prints the unified diff of the local chart files with the upstream chart of the same version, as written by
+// upgrade.
+func (c *Cmd) Diff(ctx context.Context, path string, options DiffOptions) error {
+	if options.Stat && options.NameOnly {
+		return errors.New("stat and name-only cannot be used together")
+	}
+
+	for _, chartConfig := range c.cfg.Charts {
+		if path == chartConfig.Path {
+			changes, err := c.chartLocalChanges(ctx, chartConfig)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+
+			out := io.Writer(os.Stdout)
+			if options.OutputFile != "" {
+				f, err := os.Create(options.OutputFile)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+
+			switch {
+			case options.NameOnly:
+				for _, stat := range changes.diff.Stats() {
+					_, _ = fmt.Fprintln(out, stat.Path)
+				}
+			case options.Stat:
+				printDiffStat(out, changes.diff.Stats(), options.Color)
+			case options.Color:
+				_, _ = io.WriteString(out, diff.Color(changes.diff.String()))
+			default:
+				_, _ = out.Write(changes.diff.Bytes())
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown path '%s'", path)
+}
+
+// chartLocalChanges downloads the upstream chart of the local version, and compares it with the local files.
+func (c *Cmd) chartLocalChanges(ctx context.Context, chartConfig config.Chart) (*localChanges, error) {
+	chartRoot, err := c.openChartRoot(chartConfig)
+	if err != nil {
+		return nil, err
+	}
+	defer chartRoot.Close()
+
+	currentChart, err := c.currentChartVersion(chartConfig, chartRoot)
+	if err != nil {
+		return nil, fmt.Errorf("error loading current chart version: %w", err)
+	}
+	if currentChart == nil {
+		return nil, fmt.Errorf("chart not found in path '%s'", chartConfig.Path)
+	}
+
+	repo, err := c.loadRepository(ctx, chartConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceChart, err := repo.GetLockedChart(currentChart.Name, currentChart.Version, currentChart.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceChartFiles, err := sourceChart.Download(c.chartDownloadOptions(ctx, chartConfig)...)
+	if err != nil {
+		return nil, err
+	}
+	defer sourceChartFiles.Close()
+
+	// changes made by the chart patches are not local changes. Patches which failed to apply to the local version
+	// are shown as not applied.
+	err = c.applyPatches(chartConfig, sourceChartFiles, io.Discard)
+	if err != nil && !errors.Is(err, ErrPatchFailed) {
+		return nil, err
+	}
+
+	return newLocalChanges(chartRoot, sourceChartFiles, func(iter file.Iter) file.Iter {
+		return file.IterFilter(iter, file.Filter{
+			Ignore: chartConfig.Files.Ignore,
+		})
+	})
+}
+
+// localChanges is the diff of the local chart files with the chart files of the same version.
+type localChanges struct {
+	diff *diff.Builder
+	// sourceFiles are the files of the source chart.
+	sourceFiles []string
+	// localFiles are the local files not contained in the source chart, in folders which exist in it.
+	localFiles []string
+}
+
+func newLocalChanges(chartRoot *os.Root, sourceChartFiles *helm.ChartFiles,
+	chartFileIter func(iter file.Iter) file.Iter) (*localChanges, error) {
+	changes := &localChanges{
+		diff: diff.NewBuilder(true),
+	}
+
+	sourceChartPaths := map[string][]string{}
+
+	// take diff of local code and chart code from the current version.
+	for sourceChartFile, err := range chartFileIter(sourceChartFiles.Iter()) {
+		if err != nil {
+			return nil, err
+		}
+		if sourceChartFile.Entry.IsDir() {
+			continue
+		}
+
+		changes.sourceFiles = append(changes.sourceFiles, sourceChartFile.Path)
+
+		if strings.Contains(sourceChartFile.Path, "/") {
+			sdir := path.Dir(sourceChartFile.Path)
+			sourceChartPaths[sdir] = append(sourceChartPaths[sdir], sourceChartFile.Path)
+		}
+
+		err = changes.diff.Add(sourceChartFile.Path, sourceChartFile.Path, sourceChartFiles.Root(), chartRoot,
+			sourceChartFile.Path, sourceChartFile.Path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// find new local files
+	var err error
+	changes.localFiles, err = newLocalFiles(chartRoot, sourceChartPaths)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range changes.localFiles {
+		err = changes.diff.AddLocal(p, chartRoot, p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+// printDiffStat prints the number of lines added and deleted in each file, with a histogram, as done by git.
+func printDiffStat(out io.Writer, stats []diff.FileStat, color bool) {
+	const maxBarWidth = 50
+
+	if len(stats) == 0 {
+		return
+	}
+
+	var nameWidth, maxChanges, added, deleted int
+	countWidth := 0
+	for _, stat := range stats {
+		if stat.Binary {
+			countWidth = len("Bin")
+		}
+		nameWidth = max(nameWidth, len(stat.Path))
+		maxChanges = max(maxChanges, stat.Added+stat.Deleted)
+		added += stat.Added
+		deleted += stat.Deleted
+	}
+	countWidth = max(countWidth, len(fmt.Sprint(maxChanges)))
+
+	for _, stat := range stats {
+		addedBar, deletedBar := stat.Added, stat.Deleted
+		if maxChanges > maxBarWidth {
+			addedBar = stat.Added * maxBarWidth / maxChanges
+			deletedBar = stat.Deleted * maxBarWidth / maxChanges
+		}
+		plus, minus := strings.Repeat("+", addedBar), strings.Repeat("-", deletedBar)
+		if color {
+			if plus != "" {
+				plus = diff.ColorAdded(plus)
+			}
+			if minus != "" {
+				minus = diff.ColorDeleted(minus)
+			}
+		}
+		if stat.Binary {
+			_, _ = fmt.Fprintf(out, " %-*s | %*s\n", nameWidth, stat.Path, countWidth, "Bin")
+			continue
+		}
+		_, _ = fmt.Fprintf(out, " %-*s | %*d %s%s\n", nameWidth, stat.Path, countWidth, stat.Added+stat.Deleted,
+			plus, minus)
+	}
+
+	_, _ = fmt.Fprintf(out, " %d %s changed, %d %s(+), %d %s(-)\n", len(stats), plural(len(stats), "file", "files"),
+		added, plural(added, "insertion", "insertions"), deleted, plural(deleted, "deletion", "deletions"))
+}
+
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
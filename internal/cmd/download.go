@@ -3,75 +3,116 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"time"
+	"io"
+	"os"
 
 	"github.com/rrgmc/helm-vendor/internal/helm"
 )
 
+// Download prints the chart information, and writes the chart files or the values file if requested. The repository
+// options set the cache and the offline mode.
 func Download(ctx context.Context, repoURL string, name string, version string, allVersions bool,
-	outputValuesFile bool, outputPath string) error {
-	repo, err := helm.LoadRepository(repoURL)
+	outputValuesFile bool, outputPath string, output OutputFormat, options ...helm.RepositoryOption) error {
+	info, err := downloadChart(ctx, repoURL, name, version, allVersions, outputValuesFile, outputPath, output,
+		options...)
 	if err != nil {
 		return err
 	}
+	if output != OutputFormatTable {
+		return writeOutput(os.Stdout, output, info)
+	}
+	return nil
+}
 
-	latestChart, err := repo.GetChart(name, version)
-	if err != nil {
-		return err
+// downloadChart prints the chart information in the table output format, and writes the chart files or the values
+// file if requested. Returns the chart information.
+func downloadChart(ctx context.Context, repoURL string, name string, version string, allVersions bool,
+	outputValuesFile bool, outputPath string, output OutputFormat, options ...helm.RepositoryOption) (ChartInfo, error) {
+	if outputValuesFile && output != OutputFormatTable {
+		return ChartInfo{}, fmt.Errorf("the values file cannot be output in the '%s' output format", output)
 	}
 
-	var descPrefix string
-	if outputValuesFile {
-		descPrefix = "# helm-vendor: "
+	repo, err := helm.LoadRepository(ctx, repoURL, options...)
+	if err != nil {
+		return ChartInfo{}, err
 	}
 
-	fmt.Printf("%s%s:\n", descPrefix, latestChart.Chart().Name)
+	latestChart, err := repo.GetChart(name, version)
+	if err != nil {
+		return ChartInfo{}, err
+	}
 
-	if latestChart.Chart().Description != "" {
-		fmt.Printf("%s- description: %s\n", descPrefix, latestChart.Chart().Description)
+	info := ChartInfo{
+		Name:        latestChart.Chart().Name,
+		Description: latestChart.Chart().Description,
+		Repository:  repo.URL(),
 	}
 	if version == "" {
-		fmt.Printf("%s- latest: %s\n", descPrefix, helm.GetChartVersion(latestChart.Chart()))
+		info.LatestVersion = helm.GetChartVersion(latestChart.Chart())
 	} else {
-		fmt.Printf("%s- requested version: %s\n", descPrefix, helm.GetChartVersion(latestChart.Chart()))
+		info.RequestedVersion = helm.GetChartVersion(latestChart.Chart())
 	}
 	if !outputValuesFile {
-		fmt.Printf("- versions:\n")
 		maxVersions := 15
 		if allVersions {
 			maxVersions = -1
 		}
-		for entry, err := range repo.ChartVersions(name, maxVersions) {
-			if err != nil {
-				fmt.Printf("error listing chart versions: %s\n", err)
-				break
-			}
-			var date string
-			if !entry.Created.IsZero() {
-				date = fmt.Sprintf(" [%s]", entry.Created.Format(time.RFC3339))
+		info.Versions, err = chartVersionInfos(repo.ChartVersions(name, maxVersions))
+		if err != nil {
+			info.Error = fmt.Sprintf("error listing chart versions: %s", err)
+		}
+	}
+
+	// with a machine-readable output, messages are written to stderr.
+	var out io.Writer = os.Stdout
+	if output != OutputFormatTable {
+		out = os.Stderr
+	}
+
+	var descPrefix string
+	if outputValuesFile {
+		descPrefix = "# helm-vendor: "
+	}
+
+	if output == OutputFormatTable {
+		fmt.Printf("%s%s:\n", descPrefix, info.Name)
+
+		if info.Description != "" {
+			fmt.Printf("%s- description: %s\n", descPrefix, info.Description)
+		}
+		if version == "" {
+			fmt.Printf("%s- latest: %s\n", descPrefix, info.LatestVersion)
+		} else {
+			fmt.Printf("%s- requested version: %s\n", descPrefix, info.RequestedVersion)
+		}
+		if !outputValuesFile {
+			fmt.Printf("- versions:\n")
+			printVersions(os.Stdout, info.Versions)
+			if info.Error != "" {
+				fmt.Printf("%s\n", info.Error)
 			}
-			fmt.Printf("\t- %s%s\n", entry.Version, date)
 		}
 	}
 	if outputPath != "" {
-		fmt.Printf("%sWriting chart files to %s...\n", descPrefix, outputPath)
-		latestChartFiles, err := latestChart.Download(helm.WithChartDownloadPath(outputPath))
+		_, _ = fmt.Fprintf(out, "%sWriting chart files to %s...\n", descPrefix, outputPath)
+		latestChartFiles, err := latestChart.Download(helm.WithChartDownloadContext(ctx),
+			helm.WithChartDownloadPath(outputPath))
 		if err != nil {
-			return err
+			return info, err
 		}
 		defer latestChartFiles.Close()
 	}
 
 	if outputValuesFile {
-		latestChartFiles, err := latestChart.Download()
+		latestChartFiles, err := latestChart.Download(helm.WithChartDownloadContext(ctx))
 		if err != nil {
-			return err
+			return info, err
 		}
 		defer latestChartFiles.Close()
 
 		for fi, err := range latestChartFiles.Iter() {
 			if err != nil {
-				return err
+				return info, err
 			}
 			if fi.Entry.IsDir() {
 				continue
@@ -79,14 +120,14 @@ func Download(ctx context.Context, repoURL string, name string, version string,
 			if fi.Path == "values.yaml" {
 				fd, err := latestChartFiles.Root().ReadFile(fi.Path)
 				if err != nil {
-					return err
+					return info, err
 				}
 				fmt.Println(string(fd))
-				return nil
+				return info, nil
 			}
 		}
-		return fmt.Errorf("no values.yaml found in this chart")
+		return info, fmt.Errorf("no values.yaml found in this chart")
 	}
 
-	return nil
+	return info, nil
 }
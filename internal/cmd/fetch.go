@@ -2,7 +2,9 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -14,7 +16,7 @@ import (
 func (c *Cmd) Fetch(ctx context.Context, path string, version string) error {
 	for _, chartConfig := range c.cfg.Charts {
 		if path == chartConfig.Path {
-			err := c.fetchChart(ctx, chartConfig, version)
+			err := c.fetchChart(ctx, chartConfig, version, os.Stdout)
 			if err != nil {
 				return fmt.Errorf("%s: %w", path, err)
 			}
@@ -24,7 +26,7 @@ func (c *Cmd) Fetch(ctx context.Context, path string, version string) error {
 	return fmt.Errorf("unknown path '%s'", path)
 }
 
-func (c *Cmd) fetchChart(ctx context.Context, chartConfig config.Chart, version string) error {
+func (c *Cmd) fetchChart(ctx context.Context, chartConfig config.Chart, version string, out io.Writer) error {
 	err := c.createChartRoot(chartConfig)
 	if err != nil {
 		return fmt.Errorf("error creating chart root folder: %w", err)
@@ -41,30 +43,58 @@ func (c *Cmd) fetchChart(ctx context.Context, chartConfig config.Chart, version
 		return fmt.Errorf("chart already exists in path '%s', use upgrade to download a newer version", chartConfig.Path)
 	}
 
-	repo, err := helm.LoadRepository(chartConfig.Repository.URL)
+	repo, err := c.loadRepository(ctx, chartConfig)
 	if err != nil {
 		return err
 	}
 
-	chart, err := repo.GetChart(chartConfig.Name, version)
+	var chart *helm.Chart
+	if lockChart, ok := c.lockChart(chartConfig); ok && version == "" {
+		// reproduce the locked version
+		chart, err = repo.GetLockedChart(chartConfig.Name, lockChart.Version, lockChart.Digest)
+	} else {
+		chart, err = c.resolveChart(repo, chartConfig, version, nil, "")
+	}
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Downloading '%s' [%s - %s]\n", chartConfig.Path, chart.Chart().Name, chart.Chart().Version)
+	_, _ = fmt.Fprintf(out, "Downloading '%s' [%s - %s]\n", chartConfig.Path, chart.Chart().Name, chart.Chart().Version)
 
-	chartFiles, err := chart.Download()
+	chartFiles, err := chart.Download(c.chartDownloadOptions(ctx, chartConfig)...)
 	if err != nil {
 		return err
 	}
 	defer chartFiles.Close()
 
+	if chartFiles.SignedBy() != "" {
+		_, _ = fmt.Fprintf(out, "Verified '%s' [%s - %s] signed by %s\n", chartConfig.Path, chart.Chart().Name,
+			chart.Chart().Version, chartFiles.SignedBy())
+	}
+
+	err = c.checkLockDigest(chartConfig, chartFiles)
+	if err != nil {
+		return err
+	}
+
+	// failed patches are reported after the other patches and the chart files are written.
+	patchErr := c.applyPatches(chartConfig, chartFiles, out)
+	if patchErr != nil && !errors.Is(patchErr, ErrPatchFailed) {
+		return patchErr
+	}
+
 	chartFileIter := func(iter file.Iter) file.Iter {
 		return file.IterFilter(iter, file.Filter{
 			Ignore: chartConfig.Files.Ignore,
 		})
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	files := map[string]string{}
+
 	// copy files from chart
 	for fi, err := range chartFileIter(chartFiles.Iter()) {
 		if err != nil {
@@ -82,7 +112,16 @@ func (c *Cmd) fetchChart(ctx context.Context, chartConfig config.Chart, version
 		if err != nil {
 			return err
 		}
+
+		files[fi.Path], err = file.Hash(chartFiles.Root(), fi.Path)
+		if err != nil {
+			return err
+		}
 	}
 
-	return nil
+	err = c.updateLock(chartConfig, repo, chartFiles, files)
+	if err != nil {
+		return err
+	}
+	return patchErr
 }
@@ -3,17 +3,26 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
+
+	"github.com/rrgmc/helm-vendor/internal/config"
 )
 
 func (c *Cmd) FetchAll(ctx context.Context) error {
+	var charts []config.Chart
 	for _, chartConfig := range c.cfg.Charts {
 		if c.chartRootFileExists(chartConfig) {
 			continue
 		}
-		err := c.fetchChart(ctx, chartConfig, "")
+		charts = append(charts, chartConfig)
+	}
+
+	c.forEachChart(ctx, charts, func(ctx context.Context, _ int, chartConfig config.Chart, out io.Writer) error {
+		err := c.fetchChart(ctx, chartConfig, "", out)
 		if err != nil {
-			fmt.Printf("error fetching chart: %s\n", err)
+			_, _ = fmt.Fprintf(out, "error fetching chart: %s\n", err)
 		}
-	}
-	return nil
+		return nil
+	})
+	return ctx.Err()
 }
@@ -3,7 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"time"
+	"os"
 
 	"github.com/rrgmc/helm-vendor/internal/config"
 	"github.com/rrgmc/helm-vendor/internal/helm"
@@ -20,57 +20,87 @@ func (c *Cmd) Info(ctx context.Context, path string, allVersions bool) error {
 }
 
 func (c *Cmd) infoChart(ctx context.Context, chartConfig config.Chart, allVersions bool) error {
+	maxVersions := 10
+	if allVersions {
+		maxVersions = -1
+	}
+
+	info, err := c.chartInfo(ctx, chartConfig, maxVersions)
+	if err != nil {
+		return err
+	}
+
+	if c.output != OutputFormatTable {
+		return writeOutput(os.Stdout, c.output, info)
+	}
+
 	fmt.Printf("%s:\n", chartConfig.Path)
+	if info.Description != "" {
+		fmt.Printf("- description: %s\n", info.Description)
+	}
+	if info.LocalVersion != "" {
+		fmt.Printf("- local: %s\n", info.LocalVersion)
+	} else {
+		fmt.Printf("- local: not found\n")
+	}
+	if info.Constraint != "" {
+		fmt.Printf("- constraint: %s\n", info.Constraint)
+	}
+	fmt.Printf("- latest: %s\n", info.LatestVersion)
+	fmt.Printf("- versions:\n")
+	printVersions(os.Stdout, info.Versions)
+	if info.Error != "" {
+		fmt.Printf("%s\n", info.Error)
+	}
+
+	return nil
+}
+
+// chartInfo returns the information of the configured chart, listing up to maxVersions versions (-1 for all, 0 for
+// none). Errors listing the versions are returned in the info Error field.
+func (c *Cmd) chartInfo(ctx context.Context, chartConfig config.Chart, maxVersions int) (ChartInfo, error) {
+	info := ChartInfo{
+		Path:       chartConfig.Path,
+		Name:       chartConfig.Name,
+		Constraint: chartConfig.Version,
+	}
 
-	currentChartFilename := "Chart.yaml"
 	var currentChart *repo.ChartVersion
 	if c.chartRootExists(chartConfig) {
 		chartRoot, err := c.openChartRoot(chartConfig)
 		if err != nil {
-			return err
+			return info, err
 		}
 		defer chartRoot.Close()
 
-		currentChart, err = helm.LoadHelmChartVersionFile(chartRoot, currentChartFilename)
+		currentChart, err = c.currentChartVersion(chartConfig, chartRoot)
 		if err != nil {
-			return fmt.Errorf("error loading chart file %s: %w\n", currentChartFilename, err)
+			return info, err
 		}
 	}
+	if currentChart != nil {
+		info.LocalVersion = currentChart.Version
+	}
 
-	repository, err := helm.LoadRepository(chartConfig.Repository.URL)
+	repository, err := c.loadRepository(ctx, chartConfig)
 	if err != nil {
-		return err
+		return info, err
 	}
+	info.Repository = repository.URL()
 
-	latestChart, err := repository.GetChart(chartConfig.Name, "")
+	latestChart, err := c.resolveChart(repository, chartConfig, "", nil, "")
 	if err != nil {
-		return err
-	}
-	if latestChart.Chart().Description != "" {
-		fmt.Printf("- description: %s\n", latestChart.Chart().Description)
-	}
-	if currentChart != nil {
-		fmt.Printf("- local: %s\n", currentChart.Version)
-	} else {
-		fmt.Printf("- local: not found\n")
-	}
-	fmt.Printf("- latest: %s\n", helm.GetChartVersion(latestChart.Chart()))
-	fmt.Printf("- versions:\n")
-	maxVersions := 10
-	if allVersions {
-		maxVersions = -1
+		return info, err
 	}
-	for entry, err := range repository.ChartVersions(chartConfig.Name, maxVersions) {
+	info.Description = latestChart.Chart().Description
+	info.LatestVersion = helm.GetChartVersion(latestChart.Chart())
+
+	if maxVersions != 0 {
+		info.Versions, err = chartVersionInfos(repository.ChartVersions(chartConfig.Name, maxVersions))
 		if err != nil {
-			fmt.Printf("error listing chart versions: %s\n", err)
-			break
+			info.Error = fmt.Sprintf("error listing chart versions: %s", err)
 		}
-		var date string
-		if !entry.Created.IsZero() {
-			date = fmt.Sprintf(" [%s]", entry.Created.Format(time.RFC3339))
-		}
-		fmt.Printf("\t- %s%s\n", entry.Version, date)
 	}
 
-	return nil
+	return info, nil
 }
@@ -3,62 +3,54 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/rrgmc/helm-vendor/internal/config"
-	"github.com/rrgmc/helm-vendor/internal/file"
-	"github.com/rrgmc/helm-vendor/internal/helm"
-	"helm.sh/helm/v3/pkg/repo"
 )
 
 func (c *Cmd) InfoAll(ctx context.Context) error {
-	for _, chartConfig := range c.cfg.Charts {
+	infos := make([]ChartInfo, len(c.cfg.Charts))
+
+	c.forEachChart(ctx, c.cfg.Charts, func(ctx context.Context, index int, chartConfig config.Chart, out io.Writer) error {
+		if c.output != OutputFormatTable {
+			out = io.Discard
+		}
 		if !c.chartRootExists(chartConfig) {
-			fmt.Printf("! %s: not found\n", chartConfig.Path)
-			continue
+			infos[index] = ChartInfo{Path: chartConfig.Path, Name: chartConfig.Name, Error: "not found"}
+			_, _ = fmt.Fprintf(out, "! %s: not found\n", chartConfig.Path)
+			return nil
 		}
-		err := c.runInfoAll(ctx, chartConfig)
+		info, err := c.chartInfo(ctx, chartConfig, 0)
 		if err != nil {
-			fmt.Printf("! %s: error getting info: %s\n", chartConfig.Path, err)
+			info.Error = fmt.Sprintf("error getting info: %s", err)
+			_, _ = fmt.Fprintf(out, "! %s: error getting info: %s\n", chartConfig.Path, err)
+		} else {
+			printInfoAll(out, info)
 		}
-	}
-	return nil
-}
-
-func (c *Cmd) runInfoAll(ctx context.Context, chartConfig config.Chart) error {
-	chartRoot, err := c.openChartRoot(chartConfig)
-	if err != nil {
+		infos[index] = info
+		return nil
+	})
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-	defer chartRoot.Close()
 
-	currentChartFilename := "Chart.yaml"
-	var currentChart *repo.ChartVersion
-	if file.Exists(chartRoot, currentChartFilename) {
-		var err error
-		currentChart, err = helm.LoadHelmChartVersionFile(chartRoot, currentChartFilename)
-		if err != nil {
-			return fmt.Errorf("error loading chart file %s: %w\n", currentChartFilename, err)
-		}
-	}
-
-	repository, err := helm.LoadRepository(chartConfig.Repository.URL)
-	if err != nil {
-		return err
-	}
-
-	latestChart, err := repository.GetChart(chartConfig.Name, "")
-	if err != nil {
-		return err
+	if c.output != OutputFormatTable {
+		return writeOutput(os.Stdout, c.output, infos)
 	}
+	return nil
+}
 
-	fmt.Printf("- %s:", chartConfig.Path)
-	if currentChart != nil {
-		fmt.Printf(" [local: %s]", currentChart.Version)
+func printInfoAll(out io.Writer, info ChartInfo) {
+	_, _ = fmt.Fprintf(out, "- %s:", info.Path)
+	if info.LocalVersion != "" {
+		_, _ = fmt.Fprintf(out, " [local: %s]", info.LocalVersion)
 	} else {
-		fmt.Printf(" [local: not found]")
+		_, _ = fmt.Fprintf(out, " [local: not found]")
 	}
-	fmt.Printf(" [latest: %s]", helm.GetChartVersion(latestChart.Chart()))
-	fmt.Printf("\n")
-
-	return nil
+	if info.Constraint != "" {
+		_, _ = fmt.Fprintf(out, " [constraint: %s]", info.Constraint)
+	}
+	_, _ = fmt.Fprintf(out, " [latest: %s]", info.LatestVersion)
+	_, _ = fmt.Fprintf(out, "\n")
 }
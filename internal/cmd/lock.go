@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rrgmc/helm-vendor/internal/config"
+	"github.com/rrgmc/helm-vendor/internal/file"
+	"github.com/rrgmc/helm-vendor/internal/helm"
+	"github.com/rrgmc/helm-vendor/internal/lock"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// currentChartVersion returns the locally vendored chart version. The lock file is used if it has an entry for the
+// chart, otherwise the Chart.yaml file from the chart root is loaded. Returns nil if the chart was not vendored.
+func (c *Cmd) currentChartVersion(chartConfig config.Chart, chartRoot *os.Root) (*repo.ChartVersion, error) {
+	if lockChart, ok := c.lockChart(chartConfig); ok {
+		return &repo.ChartVersion{
+			Metadata: &chart.Metadata{
+				Name:    lockChart.Name,
+				Version: lockChart.Version,
+			},
+			Digest: lockChart.Digest,
+		}, nil
+	}
+
+	currentChartFilename := "Chart.yaml"
+	if !file.Exists(chartRoot, currentChartFilename) {
+		return nil, nil
+	}
+	currentChart, err := helm.LoadHelmChartVersionFile(chartRoot, currentChartFilename)
+	if err != nil {
+		return nil, fmt.Errorf("error loading chart file %s: %w", currentChartFilename, err)
+	}
+	return currentChart, nil
+}
+
+// lockChart returns the lock file entry of the chart.
+func (c *Cmd) lockChart(chartConfig config.Chart) (lock.Chart, bool) {
+	c.lockMu.Lock()
+	defer c.lockMu.Unlock()
+	return c.lock.Get(chartConfig.Path)
+}
+
+// checkLockDigest checks if the downloaded chart matches the digest recorded in the lock file for the same version.
+func (c *Cmd) checkLockDigest(chartConfig config.Chart, chartFiles *helm.ChartFiles) error {
+	lockChart, ok := c.lockChart(chartConfig)
+	if !ok || lockChart.Digest == "" || lockChart.Version != chartFiles.Chart().Chart().Version {
+		return nil
+	}
+	if lockChart.Digest != chartFiles.Digest() {
+		return fmt.Errorf("chart %s version %s digest %s does not match the locked digest %s",
+			chartFiles.Chart().Chart().Name, lockChart.Version, chartFiles.Digest(), lockChart.Digest)
+	}
+	return nil
+}
+
+// updateLock records the vendored chart version and file hashes in the lock file.
+func (c *Cmd) updateLock(chartConfig config.Chart, repository *helm.Repository, chartFiles *helm.ChartFiles,
+	files map[string]string) error {
+	c.lockMu.Lock()
+	defer c.lockMu.Unlock()
+
+	c.lock.Set(lock.Chart{
+		Path:       chartConfig.Path,
+		Name:       chartFiles.Chart().Chart().Name,
+		Version:    chartFiles.Chart().Chart().Version,
+		Repository: repository.URL(),
+		Digest:     chartFiles.Digest(),
+		SignedBy:   chartFiles.SignedBy(),
+		Files:      files,
+	})
+	if c.lockFile == "" {
+		return nil
+	}
+	err := c.lock.SaveToFile(c.lockFile)
+	if err != nil {
+		return fmt.Errorf("error writing lock file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/rrgmc/helm-vendor/internal/config"
+	"github.com/rrgmc/helm-vendor/internal/helm"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+var ErrOutdated = errors.New("chart updates are available")
+
+// OutdatedChart is the result of checking a vendored chart for a newer version.
+type OutdatedChart struct {
+	Path          string `json:"path"`
+	LocalVersion  string `json:"localVersion,omitempty"`
+	LatestVersion string `json:"latestVersion,omitempty"`
+	Outdated      bool   `json:"outdated"`
+	Error         string `json:"error,omitempty"`
+}
+
+// Outdated compares the local version of each vendored chart with the latest version allowed by the policy.
+// Returns ErrOutdated if any chart can be upgraded, or an error if any chart could not be checked.
+func (c *Cmd) Outdated(ctx context.Context, policy VersionPolicy) error {
+	var charts []config.Chart
+	for _, chartConfig := range c.cfg.Charts {
+		if !c.chartRootFileExists(chartConfig) {
+			continue
+		}
+		charts = append(charts, chartConfig)
+	}
+
+	results := make([]OutdatedChart, len(charts))
+
+	chartErrs := c.forEachChart(ctx, charts, func(ctx context.Context, index int, chartConfig config.Chart, out io.Writer) error {
+		if c.output != OutputFormatTable {
+			out = io.Discard
+		}
+		result, err := c.outdatedChart(ctx, chartConfig, policy)
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+			_, _ = fmt.Fprintf(out, "! %s: error: %s\n", chartConfig.Path, err)
+		case result.Outdated:
+			_, _ = fmt.Fprintf(out, "- %s: [%s => %s] outdated\n", chartConfig.Path, result.LocalVersion,
+				result.LatestVersion)
+		default:
+			_, _ = fmt.Fprintf(out, "- %s: [%s] up to date\n", chartConfig.Path, result.LocalVersion)
+		}
+		results[index] = result
+		return err
+	})
+
+	if c.output != OutputFormatTable {
+		err := writeOutput(os.Stdout, c.output, results)
+		if err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	for i, err := range chartErrs {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", charts[i].Path, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	for _, result := range results {
+		if result.Outdated {
+			return ErrOutdated
+		}
+	}
+	return nil
+}
+
+func (c *Cmd) outdatedChart(ctx context.Context, chartConfig config.Chart, policy VersionPolicy) (OutdatedChart, error) {
+	result := OutdatedChart{
+		Path: chartConfig.Path,
+	}
+
+	chartRoot, err := c.openChartRoot(chartConfig)
+	if err != nil {
+		return result, err
+	}
+	defer chartRoot.Close()
+
+	currentChart, err := c.currentChartVersion(chartConfig, chartRoot)
+	if err != nil {
+		return result, fmt.Errorf("error loading current chart version: %w", err)
+	}
+	if currentChart == nil {
+		return result, fmt.Errorf("chart not found in path '%s'", chartConfig.Path)
+	}
+	result.LocalVersion = helm.GetChartVersion(currentChart)
+
+	repository, err := c.loadRepository(ctx, chartConfig)
+	if err != nil {
+		return result, err
+	}
+
+	latestChart, err := c.resolveChart(repository, chartConfig, "", currentChart, policy)
+	if err != nil {
+		return result, err
+	}
+	result.LatestVersion = helm.GetChartVersion(latestChart.Chart())
+
+	result.Outdated = isOutdated(latestChart.Chart(), currentChart)
+
+	return result, nil
+}
+
+// isOutdated returns whether the latest chart version is newer than the current one. A git ref is used as the
+// version of all its commits, so the same version is outdated if the ref moved from the locked commit.
+func isOutdated(latest, current *repo.ChartVersion) bool {
+	if latest.Version == current.Version && strings.HasPrefix(latest.Digest, "git:") && current.Digest != "" {
+		return latest.Digest != current.Digest
+	}
+	return isNewerVersion(latest.Version, current.Version)
+}
+
+// isNewerVersion returns whether version is newer than currentVersion, so a local version newer than the latest
+// allowed one is not outdated. Versions which are not semantic versions are compared for equality.
+func isNewerVersion(version, currentVersion string) bool {
+	newVersion, nerr := semver.NewVersion(version)
+	current, cerr := semver.NewVersion(currentVersion)
+	if nerr == nil && cerr == nil {
+		return newVersion.GreaterThan(current)
+	}
+	return version != currentVersion
+}
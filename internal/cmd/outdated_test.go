@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+func TestIsNewerVersion(t *testing.T) {
+	tests := []struct {
+		version        string
+		currentVersion string
+		want           bool
+	}{
+		{"1.3.0", "1.2.0", true},
+		{"1.2.0", "1.2.0", false},
+		{"1.2.0", "1.3.0", false},
+		{"1.3.0", "1.3.0-rc.1", true},
+		{"1.2.0", "1.3.0-rc.1", false},
+		{"v1.2.0", "1.2.0", false},
+		{"main", "develop", true},
+		{"main", "main", false},
+	}
+	for _, tt := range tests {
+		if got := isNewerVersion(tt.version, tt.currentVersion); got != tt.want {
+			t.Errorf("isNewerVersion(%q, %q) = %v, want %v", tt.version, tt.currentVersion, got, tt.want)
+		}
+	}
+}
+
+func TestIsOutdated(t *testing.T) {
+	chartVersion := func(version, digest string) *repo.ChartVersion {
+		return &repo.ChartVersion{Metadata: &chart.Metadata{Name: "demo", Version: version}, Digest: digest}
+	}
+	tests := []struct {
+		name    string
+		latest  *repo.ChartVersion
+		current *repo.ChartVersion
+		want    bool
+	}{
+		{"newer version", chartVersion("1.3.0", "abc"), chartVersion("1.2.0", "sha256:def"), true},
+		{"same version with index digest", chartVersion("1.2.0", "abc"), chartVersion("1.2.0", "sha256:abc"), false},
+		{"same git commit", chartVersion("main", "git:abc"), chartVersion("main", "git:abc"), false},
+		{"moved git ref", chartVersion("main", "git:def"), chartVersion("main", "git:abc"), true},
+		{"git ref without lock", chartVersion("main", "git:def"), chartVersion("main", ""), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isOutdated(tt.latest, tt.current); got != tt.want {
+				t.Errorf("isOutdated() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"time"
+
+	"github.com/rrgmc/helm-vendor/internal/helm"
+	"github.com/rrgmc/helm-vendor/internal/yaml"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// OutputFormat is the output format of the commands which support machine-readable output.
+type OutputFormat string
+
+const (
+	// OutputFormatTable is the human-readable output.
+	OutputFormatTable OutputFormat = "table"
+	// OutputFormatJSON outputs the typed results as JSON.
+	OutputFormatJSON OutputFormat = "json"
+	// OutputFormatYAML outputs the typed results as YAML.
+	OutputFormatYAML OutputFormat = "yaml"
+)
+
+func ParseOutputFormat(output string) (OutputFormat, error) {
+	switch OutputFormat(output) {
+	case "", OutputFormatTable:
+		return OutputFormatTable, nil
+	case OutputFormatJSON, OutputFormatYAML:
+		return OutputFormat(output), nil
+	default:
+		return "", fmt.Errorf("invalid output format '%s'", output)
+	}
+}
+
+// ChartInfo is the information of a chart, returned by the info, download and dependency commands.
+type ChartInfo struct {
+	// Path is the chart path in the configuration file, if it is a configured chart.
+	Path        string `json:"path,omitempty"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Repository  string `json:"repository,omitempty"`
+	// LocalVersion is the vendored version, blank if the chart was not fetched.
+	LocalVersion string `json:"localVersion,omitempty"`
+	// Constraint is the chart version constraint from the configuration file.
+	Constraint string `json:"constraint,omitempty"`
+	// LatestVersion is the latest version, or the latest version matching the constraint.
+	LatestVersion string `json:"latestVersion,omitempty"`
+	// RequestedVersion is the version requested in the command line.
+	RequestedVersion string             `json:"requestedVersion,omitempty"`
+	Versions         []ChartVersionInfo `json:"versions,omitempty"`
+	Error            string             `json:"error,omitempty"`
+}
+
+type ChartVersionInfo struct {
+	Version    string     `json:"version"`
+	Created    *time.Time `json:"created,omitempty"`
+	Prerelease bool       `json:"prerelease,omitempty"`
+}
+
+// chartVersionInfos lists the chart versions, returning the error of the listing if any.
+func chartVersionInfos(versions iter.Seq2[*repo.ChartVersion, error]) ([]ChartVersionInfo, error) {
+	var ret []ChartVersionInfo
+	for entry, err := range versions {
+		if err != nil {
+			return ret, err
+		}
+		info := ChartVersionInfo{
+			Version:    entry.Version,
+			Prerelease: helm.IsPrerelease(entry.Version),
+		}
+		if !entry.Created.IsZero() {
+			info.Created = &entry.Created
+		}
+		ret = append(ret, info)
+	}
+	return ret, nil
+}
+
+// printVersions prints the versions list in the table format.
+func printVersions(w io.Writer, versions []ChartVersionInfo) {
+	for _, version := range versions {
+		var date, prerelease string
+		if version.Created != nil {
+			date = fmt.Sprintf(" [%s]", version.Created.Format(time.RFC3339))
+		}
+		if version.Prerelease {
+			prerelease = " (pre-release)"
+		}
+		_, _ = fmt.Fprintf(w, "\t- %s%s%s\n", version.Version, date, prerelease)
+	}
+}
+
+// writeOutput writes the data in the JSON or YAML output format.
+func writeOutput(w io.Writer, output OutputFormat, data any) error {
+	switch output {
+	case OutputFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(data)
+	case OutputFormatYAML:
+		return yaml.Encode(w, data)
+	default:
+		return fmt.Errorf("output format '%s' is not machine-readable", output)
+	}
+}
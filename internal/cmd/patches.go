@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rrgmc/helm-vendor/internal/config"
+	"github.com/rrgmc/helm-vendor/internal/diff"
+	"github.com/rrgmc/helm-vendor/internal/helm"
+)
+
+var ErrPatchFailed = errors.New("patches failed to apply")
+
+// applyPatches applies the chart patches to the downloaded chart files, in the series order. Each patch is applied to
+// all its files, or not at all. Returns ErrPatchFailed if any patch failed, after trying all of them.
+func (c *Cmd) applyPatches(chartConfig config.Chart, chartFiles *helm.ChartFiles, out io.Writer) error {
+	if chartConfig.Patches == "" {
+		return nil
+	}
+	patchesPath := config.ResolvePath(c.rootPath, chartConfig.Patches)
+
+	series, err := loadPatchSeries(patchesPath)
+	if err != nil {
+		return fmt.Errorf("error loading patches: %w", err)
+	}
+
+	var failed []string
+	for _, name := range series {
+		skipped, err := applyPatch(filepath.Join(patchesPath, name), chartFiles.Root())
+		if err != nil {
+			_, _ = fmt.Fprintf(out, "Failed to apply patch '%s': %s\n", name, err)
+			failed = append(failed, name)
+			continue
+		}
+		_, _ = fmt.Fprintf(out, "Applied patch '%s'\n", name)
+		for _, p := range skipped {
+			_, _ = fmt.Fprintf(out, "\t- skipped binary file without patch data: %s\n", p)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: %s", ErrPatchFailed, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// applyPatch applies the patch file to root, returning the skipped binary files.
+func applyPatch(filename string, root *os.Root) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	patcher, err := diff.NewPatcher(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return patcher.Apply(root)
+}
+
+// loadPatchSeries returns the patch file names, from the "series" file in the patches folder as done by quilt, with
+// one patch per line and "#" comments. Without a series file, all ".patch" and ".diff" files are used, sorted by
+// name. A patches folder which doesn't exist has no patches.
+func loadPatchSeries(patchesPath string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(patchesPath, "series"))
+	if err == nil {
+		var series []string
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line, _, _ := strings.Cut(scanner.Text(), "#")
+			// patch options after the name are not supported, and ignored.
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			series = append(series, fields[0])
+		}
+		return series, scanner.Err()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(patchesPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var series []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if ext := filepath.Ext(entry.Name()); ext == ".patch" || ext == ".diff" {
+			series = append(series, entry.Name())
+		}
+	}
+	slices.Sort(series)
+	return series, nil
+}
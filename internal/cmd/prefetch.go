@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rrgmc/helm-vendor/internal/config"
+	"github.com/rrgmc/helm-vendor/internal/helm"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// Prefetch downloads the repository index file and the chart archives needed to run the other commands offline.
+func (c *Cmd) Prefetch(ctx context.Context, path string) error {
+	for _, chartConfig := range c.cfg.Charts {
+		if path == chartConfig.Path {
+			return c.prefetchChart(ctx, chartConfig)
+		}
+	}
+	return fmt.Errorf("unknown path '%s'", path)
+}
+
+func (c *Cmd) PrefetchAll(ctx context.Context) error {
+	var errs []error
+	for _, chartConfig := range c.cfg.Charts {
+		err := c.prefetchChart(ctx, chartConfig)
+		if err != nil {
+			fmt.Printf("! %s: error prefetching: %s\n", chartConfig.Path, err)
+			errs = append(errs, fmt.Errorf("%s: %w", chartConfig.Path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// prefetchChart caches the local chart version, and the latest version allowed by each version policy.
+func (c *Cmd) prefetchChart(ctx context.Context, chartConfig config.Chart) error {
+	if c.cache == nil {
+		return errors.New("prefetch requires the cache")
+	}
+	if c.offline {
+		return errors.New("prefetch cannot be used in offline mode")
+	}
+
+	repository, err := c.loadRepository(ctx, chartConfig)
+	if err != nil {
+		return err
+	}
+
+	var charts []*helm.Chart
+
+	var currentChart *repo.ChartVersion
+	if c.chartRootExists(chartConfig) {
+		chartRoot, err := c.openChartRoot(chartConfig)
+		if err != nil {
+			return err
+		}
+		currentChart, err = c.currentChartVersion(chartConfig, chartRoot)
+		_ = chartRoot.Close()
+		if err != nil {
+			return err
+		}
+	} else if lockChart, ok := c.lockChart(chartConfig); ok {
+		currentChart = &repo.ChartVersion{
+			Metadata: &chart.Metadata{Name: lockChart.Name, Version: lockChart.Version},
+			Digest:   lockChart.Digest,
+		}
+	}
+
+	if currentChart != nil {
+		sourceChart, err := repository.GetLockedChart(currentChart.Name, currentChart.Version, currentChart.Digest)
+		if err != nil {
+			return err
+		}
+		charts = append(charts, sourceChart)
+	}
+
+	for _, policy := range []VersionPolicy{VersionPolicyLatest, VersionPolicyMinor, VersionPolicyPatch} {
+		latestChart, err := c.resolveChart(repository, chartConfig, "", currentChart, policy)
+		if err != nil {
+			return err
+		}
+		charts = append(charts, latestChart)
+		if currentChart == nil {
+			// policies are relative to the current version
+			break
+		}
+	}
+
+	var versions []string
+	for _, prefetchChart := range charts {
+		version := prefetchChart.Chart().Version
+		if slices.Contains(versions, version) {
+			continue
+		}
+		err := prefetchChart.Prefetch(c.chartDownloadOptions(ctx, chartConfig)...)
+		if err != nil {
+			return fmt.Errorf("error prefetching version %s: %w", version, err)
+		}
+		versions = append(versions, version)
+	}
+
+	fmt.Printf("- %s: [cached: %s]\n", chartConfig.Path, strings.Join(versions, ", "))
+	return nil
+}
@@ -1,10 +1,10 @@
 package cmd
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path"
@@ -12,168 +12,305 @@ import (
 	"slices"
 	"strings"
 
-	"github.com/bluekeyes/go-gitdiff/gitdiff"
 	"github.com/rrgmc/helm-vendor/internal/config"
-	"github.com/rrgmc/helm-vendor/internal/diff"
 	"github.com/rrgmc/helm-vendor/internal/file"
 	"github.com/rrgmc/helm-vendor/internal/helm"
+	"helm.sh/helm/v3/pkg/repo"
 )
 
-func (c *Cmd) Upgrade(ctx context.Context, path string, version string, ignoreCurrent bool, applyPatch bool,
-	latestChartOutputPath string, currentChartOutputPath string) error {
+type UpgradeOptions struct {
+	// IgnoreCurrent ignores the current release, just unpacking the new version over it.
+	IgnoreCurrent bool
+	// ApplyPatch merges the local changes into the new version, with a three-way merge of the chart of the local
+	// version, the local files and the new version. Conflicting changes are written as git-style conflict markers.
+	ApplyPatch bool
+	// DryRun only prints the upgrade plan, without changing any local file.
+	DryRun bool
+	// LatestChartOutputPath extracts the latest chart in this path instead of a temporary.
+	LatestChartOutputPath string
+	// CurrentChartOutputPath extracts the current chart in this path instead of a temporary.
+	CurrentChartOutputPath string
+	// Policy restricts the newer versions considered when no version is passed.
+	Policy VersionPolicy
+	// Orphaned is what is done with the files removed in the new version which have local changes.
+	Orphaned OrphanPolicy
+	// Binary is which copy of binary files with local changes is kept, as they can't be merged.
+	Binary BinaryPolicy
+}
+
+// BinaryPolicy is which copy of the binary files with local changes is kept on upgrade.
+type BinaryPolicy string
+
+const (
+	// BinaryPolicyLocal keeps the local copy.
+	BinaryPolicyLocal BinaryPolicy = "local"
+	// BinaryPolicyUpstream keeps the copy from the new version.
+	BinaryPolicyUpstream BinaryPolicy = "upstream"
+)
+
+func ParseBinaryPolicy(policy string) (BinaryPolicy, error) {
+	switch BinaryPolicy(policy) {
+	case "", BinaryPolicyUpstream:
+		return BinaryPolicyUpstream, nil
+	case BinaryPolicyLocal:
+		return BinaryPolicyLocal, nil
+	default:
+		return "", fmt.Errorf("invalid binary policy '%s'", policy)
+	}
+}
+
+// OrphanPolicy is what is done with the local files removed in the new chart version which have local changes.
+type OrphanPolicy string
+
+const (
+	// OrphanPolicyKeep keeps the files in place.
+	OrphanPolicyKeep OrphanPolicy = "keep"
+	// OrphanPolicyMove moves the files to the ".orphaned" folder in the chart folder.
+	OrphanPolicyMove OrphanPolicy = "move"
+	// OrphanPolicyFail fails the upgrade without changing any file.
+	OrphanPolicyFail OrphanPolicy = "fail"
+)
+
+// orphanedPath is the folder in the chart folder where the orphaned files are moved to.
+const orphanedPath = ".orphaned"
+
+var ErrOrphanedFiles = errors.New("files removed in the new version have local changes")
+
+func ParseOrphanPolicy(policy string) (OrphanPolicy, error) {
+	switch OrphanPolicy(policy) {
+	case "", OrphanPolicyMove:
+		return OrphanPolicyMove, nil
+	case OrphanPolicyKeep, OrphanPolicyFail:
+		return OrphanPolicy(policy), nil
+	default:
+		return "", fmt.Errorf("invalid orphan policy '%s'", policy)
+	}
+}
+
+type upgradeResult struct {
+	currentVersion string
+	newVersion     string
+	upToDate       bool
+	// orphaned are the files removed in the new version which have local changes.
+	orphaned []string
+}
+
+func (c *Cmd) Upgrade(ctx context.Context, path string, version string, options UpgradeOptions) error {
 	for _, chartConfig := range c.cfg.Charts {
 		if path == chartConfig.Path {
-			return c.upgradeChart(ctx, chartConfig, version, ignoreCurrent, applyPatch,
-				latestChartOutputPath, currentChartOutputPath)
+			_, err := c.upgradeChart(ctx, chartConfig, version, options, false, os.Stdout)
+			return err
 		}
 	}
 	return fmt.Errorf("unknown path '%s'", path)
 }
 
-func (c *Cmd) upgradeChart(ctx context.Context, chartConfig config.Chart, version string, ignoreCurrent bool, applyPatch bool,
-	latestChartOutputPath string, currentChartOutputPath string) error {
+// upgradeChart upgrades the chart to the passed version, or to the latest one allowed by the policy. If onlyOutdated
+// is true, nothing is done if the chart is already at this version or a newer one.
+func (c *Cmd) upgradeChart(ctx context.Context, chartConfig config.Chart, version string, options UpgradeOptions,
+	onlyOutdated bool, out io.Writer) (upgradeResult, error) {
+	var result upgradeResult
+
 	chartRoot, err := c.openChartRoot(chartConfig)
 	if err != nil {
-		return err
+		return result, err
 	}
 	defer chartRoot.Close()
 
-	currentChartFilename := "Chart.yaml"
-	if !file.Exists(chartRoot, currentChartFilename) {
-		return fmt.Errorf("chart not found in path '%s', use fetch to download an initial version", chartConfig.Path)
-	}
-
-	// load the Chart.yaml file for the current version
-	currentChartVersionFile, err := helm.LoadHelmChartVersionFile(chartRoot, currentChartFilename)
+	// load the current version from the lock file or the Chart.yaml file
+	currentChartVersionFile, err := c.currentChartVersion(chartConfig, chartRoot)
 	if err != nil {
-		return fmt.Errorf("error loading current chart version file: %w", err)
+		return result, fmt.Errorf("error loading current chart version: %w", err)
 	}
+	if currentChartVersionFile == nil {
+		return result, fmt.Errorf("chart not found in path '%s', use fetch to download an initial version", chartConfig.Path)
+	}
+
+	result.currentVersion = helm.GetChartVersion(currentChartVersionFile)
 
-	repo, err := helm.LoadRepository(chartConfig.Repository.URL)
+	repo, err := c.loadRepository(ctx, chartConfig)
 	if err != nil {
-		return err
+		return result, err
 	}
 
 	// download the new chart version
-	latestChart, err := repo.GetChart(chartConfig.Name, version)
+	latestChart, err := c.resolveChart(repo, chartConfig, version, currentChartVersionFile, options.Policy)
 	if err != nil {
-		return err
+		return result, err
 	}
 
-	fmt.Printf("Downloading new version of '%s' [%s - %s]\n", chartConfig.Path, latestChart.Chart().Name, helm.GetChartVersion(latestChart.Chart()))
+	result.newVersion = helm.GetChartVersion(latestChart.Chart())
+	if onlyOutdated && !isOutdated(latestChart.Chart(), currentChartVersionFile) {
+		result.upToDate = true
+		return result, nil
+	}
+
+	_, _ = fmt.Fprintf(out, "Downloading new version of '%s' [%s - %s]\n", chartConfig.Path, latestChart.Chart().Name, helm.GetChartVersion(latestChart.Chart()))
 
-	var lcDownloadOptions []helm.ChartDownloadOption
-	if latestChartOutputPath != "" {
-		lcDownloadOptions = append(lcDownloadOptions, helm.WithChartDownloadPath(latestChartOutputPath))
+	lcDownloadOptions := c.chartDownloadOptions(ctx, chartConfig)
+	if options.LatestChartOutputPath != "" {
+		lcDownloadOptions = append(lcDownloadOptions, helm.WithChartDownloadPath(options.LatestChartOutputPath))
 	}
 
 	latestChartFiles, err := latestChart.Download(lcDownloadOptions...)
 	if err != nil {
-		return err
+		return result, err
 	}
 	defer latestChartFiles.Close()
 
-	chartFileIter := func(iter file.Iter) file.Iter {
-		return file.IterFilter(iter, file.Filter{
-			Ignore: chartConfig.Files.Ignore,
-		})
+	if latestChartFiles.SignedBy() != "" {
+		_, _ = fmt.Fprintf(out, "Verified '%s' [%s - %s] signed by %s\n", chartConfig.Path, latestChart.Chart().Name,
+			helm.GetChartVersion(latestChart.Chart()), latestChartFiles.SignedBy())
+	}
+
+	// failed patches are reported after the other patches and the upgrade are applied.
+	patchErr := c.applyPatches(chartConfig, latestChartFiles, out)
+	if patchErr != nil && !errors.Is(patchErr, ErrPatchFailed) {
+		return result, patchErr
 	}
 
-	diffBuilder := diff.NewBuilder(!ignoreCurrent)
+	var sourceChartFiles *helm.ChartFiles
 
-	if !ignoreCurrent {
-		fmt.Printf("Downloading source chart for local version [%s - %s]\n", currentChartVersionFile.Name, helm.GetChartVersion(currentChartVersionFile))
+	if !options.IgnoreCurrent {
+		_, _ = fmt.Fprintf(out, "Downloading source chart for local version [%s - %s]\n", currentChartVersionFile.Name, helm.GetChartVersion(currentChartVersionFile))
 
-		sourceChart, err := repo.GetChart(currentChartVersionFile.Name, currentChartVersionFile.Version)
+		sourceChart, err := repo.GetLockedChart(currentChartVersionFile.Name, currentChartVersionFile.Version,
+			currentChartVersionFile.Digest)
 		if err != nil {
-			return err
+			_, _ = fmt.Fprintf(out, "could not find source chart, might use the '--ignore-current' flag to ignore it\n")
+			return result, err
 		}
 
-		var scDownloadOptions []helm.ChartDownloadOption
-		if currentChartOutputPath != "" {
-			scDownloadOptions = append(scDownloadOptions, helm.WithChartDownloadPath(currentChartOutputPath))
+		scDownloadOptions := c.chartDownloadOptions(ctx, chartConfig)
+		if options.CurrentChartOutputPath != "" {
+			scDownloadOptions = append(scDownloadOptions, helm.WithChartDownloadPath(options.CurrentChartOutputPath))
 		}
 
-		sourceChartFiles, err := sourceChart.Download(scDownloadOptions...)
+		sourceChartFiles, err = sourceChart.Download(scDownloadOptions...)
 		if err != nil {
-			fmt.Printf("could not download source files, might use the '--ignore-current' flag to ignore it\n")
-			return err
+			_, _ = fmt.Fprintf(out, "could not download source files, might use the '--ignore-current' flag to ignore it\n")
+			return result, err
 		}
 		defer sourceChartFiles.Close()
 
-		sourceChartPaths := map[string][]string{}
+		// the source chart is patched as it was when vendored, so the patches are not seen as local changes.
+		err = c.applyPatches(chartConfig, sourceChartFiles, io.Discard)
+		if err != nil && !errors.Is(err, ErrPatchFailed) {
+			return result, err
+		}
+	}
 
-		// take diff of local code and chart code from the current version.
-		for sourceChartFile, err := range chartFileIter(sourceChartFiles.Iter()) {
-			if err != nil {
-				return err
-			}
-			if sourceChartFile.Entry.IsDir() {
-				continue
-			}
+	chartFileIter := func(iter file.Iter) file.Iter {
+		return file.IterFilter(iter, file.Filter{
+			Ignore: chartConfig.Files.Ignore,
+		})
+	}
 
-			if strings.Contains(sourceChartFile.Path, "/") {
-				sdir := path.Dir(sourceChartFile.Path)
-				sourceChartPaths[sdir] = append(sourceChartPaths[sdir], sourceChartFile.Path)
-			}
+	plan, err := newUpgradePlan(chartRoot, sourceChartFiles, latestChartFiles, chartFileIter, options.ApplyPatch,
+		options.Binary)
+	if err != nil {
+		return result, err
+	}
 
-			err = diffBuilder.Add(sourceChartFile.Path, sourceChartFile.Path, sourceChartFiles.Root(), chartRoot,
-				sourceChartFile.Path, sourceChartFile.Path)
-			if err != nil {
-				return err
-			}
+	// the chart folder is renamed when the staging folder is swapped in, which fails on Windows while it is open.
+	err = chartRoot.Close()
+	if err != nil {
+		return result, err
+	}
+
+	if options.Orphaned == "" {
+		options.Orphaned = OrphanPolicyMove
+	}
+	result.orphaned = plan.orphaned
+
+	if options.DryRun {
+		plan.print(out, chartConfig, currentChartVersionFile, latestChart.Chart(), options.Orphaned)
+	}
+	if len(plan.orphaned) > 0 && options.Orphaned == OrphanPolicyFail {
+		return result, fmt.Errorf("%w: %s, might use the '--orphaned' flag to keep or move them", ErrOrphanedFiles,
+			strings.Join(plan.orphaned, ", "))
+	}
+	if options.DryRun {
+		return result, patchErr
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+
+	files := map[string]string{}
+
+	// changes are done in a staging copy of the chart folder, which is swapped in only if all steps succeed.
+	err = c.stageChartRoot(chartConfig, func(stagingRoot *os.Root) error {
+		return c.applyUpgradePlan(out, chartConfig, currentChartVersionFile, plan, options.Orphaned, stagingRoot,
+			latestChartFiles, files)
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = c.updateLock(chartConfig, repo, latestChartFiles, files)
+	if err != nil {
+		return result, err
+	}
+	return result, patchErr
+}
+
+// applyUpgradePlan applies the upgrade plan to chartRoot, filling files with the hashes of the copied chart files.
+func (c *Cmd) applyUpgradePlan(out io.Writer, chartConfig config.Chart, currentChartVersionFile *repo.ChartVersion, plan *upgradePlan,
+	orphanPolicy OrphanPolicy, chartRoot *os.Root, latestChartFiles *helm.ChartFiles, files map[string]string) error {
+	// write diff
+	if !plan.diff.IsEmpty() {
+		diffFilename, err := file.GenerateUniqueFilename(chartRoot, ".",
+			filepath.Clean(fmt.Sprintf("helm-vendor-%s-%s", chartConfig.Path, currentChartVersionFile.Version)),
+			".diff")
+		if err != nil {
+			return fmt.Errorf("error generating unique diff filename: %w", err)
 		}
 
-		// find new local files
-		walkErr := fs.WalkDir(chartRoot.FS(), ".", func(p string, d fs.DirEntry, err error) error {
-			if d.IsDir() {
-				return nil
-			}
-			if strings.Contains(p, "/") {
-				sdir := path.Dir(p)
-				if sp, ok := sourceChartPaths[sdir]; ok {
-					if !slices.Contains(sp, p) {
-						err = diffBuilder.AddLocal(p, chartRoot, p)
-						if err != nil {
-							return err
-						}
-					}
-				}
-			}
-			return nil
-		})
-		if walkErr != nil {
-			return walkErr
+		_, _ = fmt.Fprintf(out, "Writing diff file with changes between local and source chart\n")
+
+		err = chartRoot.WriteFile(diffFilename, plan.diff.Bytes(), os.ModePerm)
+		if err != nil {
+			return err
 		}
+	}
 
-		// write diff
-		if !diffBuilder.IsEmpty() {
-			diffFilename, err := file.GenerateUniqueFilename(chartRoot, ".",
-				filepath.Clean(fmt.Sprintf("helm-vendor-%s-%s", chartConfig.Path, currentChartVersionFile.Version)),
-				".diff")
-			if err != nil {
-				return fmt.Errorf("error generating unique diff filename: %w", err)
-			}
+	// keep or move files removed in the new version which have local changes
+	for _, p := range plan.orphaned {
+		if orphanPolicy == OrphanPolicyKeep {
+			_, _ = fmt.Fprintf(out, "Keeping orphaned file %s (removed upstream, modified locally)\n", p)
+			continue
+		}
+
+		orphanedFilename, err := file.GenerateUniqueFilename(chartRoot, path.Join(orphanedPath, path.Dir(p)),
+			file.WithoutExt(path.Base(p)), path.Ext(p))
+		if err != nil {
+			return fmt.Errorf("error generating orphaned filename: %w", err)
+		}
 
-			fmt.Printf("Writing diff file with changes between local and source chart\n")
+		_, _ = fmt.Fprintf(out, "Moving orphaned file %s (removed upstream, modified locally) to %s\n", p,
+			orphanedFilename)
 
-			err = chartRoot.WriteFile(diffFilename, diffBuilder.Bytes(), os.ModePerm)
-			if err != nil {
-				return err
-			}
+		err = chartRoot.MkdirAll(path.Dir(orphanedFilename), os.ModePerm)
+		if err != nil {
+			return err
+		}
+		err = chartRoot.Rename(p, orphanedFilename)
+		if err != nil {
+			return fmt.Errorf("error moving orphaned file %s: %w", p, err)
 		}
+	}
 
+	if len(plan.sourceFiles) > 0 {
 		// delete current files that exist in the chart
-		fmt.Printf("Removing local files which are contained in the source chart...\n")
+		_, _ = fmt.Fprintf(out, "Removing local files which are contained in the source chart...\n")
 
-		for fi, err := range chartFileIter(sourceChartFiles.Iter()) {
-			if err != nil {
-				return err
-			}
-			if fi.Entry.IsDir() {
+		for _, p := range plan.sourceFiles {
+			if slices.Contains(plan.orphaned, p) {
 				continue
 			}
-			err = chartRoot.Remove(fi.Path)
+			err := chartRoot.Remove(p)
 			if err != nil {
 				if !errors.Is(err, fs.ErrNotExist) {
 					return err
@@ -183,79 +320,73 @@ func (c *Cmd) upgradeChart(ctx context.Context, chartConfig config.Chart, versio
 	}
 
 	// copy files from new chart
-	fmt.Printf("Copying files from new version...\n")
+	_, _ = fmt.Fprintf(out, "Copying files from new version...\n")
 
-	for fi, err := range chartFileIter(latestChartFiles.Iter()) {
+	for _, p := range plan.latestFiles {
+		err := chartRoot.MkdirAll(filepath.Dir(p), os.ModePerm)
 		if err != nil {
 			return err
 		}
-		if fi.Entry.IsDir() {
-			continue
-		}
 
-		err = chartRoot.MkdirAll(filepath.Dir(fi.Path), os.ModePerm)
+		err = file.CopyFile(latestChartFiles.Root(), chartRoot, p, p)
 		if err != nil {
 			return err
 		}
 
-		err = file.CopyFile(latestChartFiles.Root(), chartRoot, fi.Path, fi.Path)
+		files[p], err = file.Hash(latestChartFiles.Root(), p)
 		if err != nil {
 			return err
 		}
 	}
 
-	if !ignoreCurrent && applyPatch && !diffBuilder.IsEmpty() {
-		// apply patch to new files
-		patcher, err := diff.NewPatcher(diffBuilder.String())
-		if err != nil {
-			return fmt.Errorf("error loading patch file: %w", err)
-		}
-
-		for filediff := range patcher.Files() {
-			targetFileData, err := chartRoot.ReadFile(filediff.NewName)
-			if errors.Is(err, fs.ErrNotExist) {
-				fmt.Printf("patching %s failed: %s does not exist\n", filediff.NewName, filediff.NewName)
-				continue
-			} else if err != nil {
+	// write the merged local changes to the new files
+	for _, merge := range plan.merges {
+		switch {
+		case merge.removed:
+			_, _ = fmt.Fprintf(out, "removed %s, as it was removed locally\n", merge.path)
+			err := chartRoot.Remove(merge.path)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
 				return err
 			}
+			continue
+		case merge.binary:
+			_, _ = fmt.Fprintf(out, "kept local copy of binary file %s\n", merge.path)
+		case merge.conflicts > 0:
+			_, _ = fmt.Fprintf(out, "conflict merging local changes into %s: %d conflict(s) marked in the file\n",
+				merge.path, merge.conflicts)
+		default:
+			_, _ = fmt.Fprintf(out, "merged local changes into %s\n", merge.path)
+		}
 
-			// apply patch
-			var output bytes.Buffer
-			err = gitdiff.Apply(&output, bytes.NewReader(targetFileData), filediff)
-			if err != nil {
-				var fconflict *gitdiff.Conflict
-				if errors.As(err, &fconflict) {
-					fmt.Printf("conflict applying patch to %s: %s\n", filediff.NewName, err)
-
-					conflictFileName, err := file.GenerateUniqueFilename(chartRoot, filepath.Dir(filediff.NewName),
-						file.NameExtFormat(filediff.NewName)+"_conflict", ".diff")
-					if err != nil {
-						return fmt.Errorf("error generating conflict file: %w", err)
-					}
-
-					if !file.Exists(chartRoot, conflictFileName) {
-						err = chartRoot.WriteFile(conflictFileName, []byte(filediff.String()), os.ModePerm)
-						if err != nil {
-							return err
-						}
-					} else {
-						fmt.Printf("could not write conflict patch to %s: file exists\n", conflictFileName)
-					}
-				} else {
-					fmt.Printf("failed to apply patch to %s: %s\n", filediff.NewName, err)
-				}
-				continue
-			}
-
-			fmt.Printf("applied patch to %s\n", filediff.NewName)
-
-			err = chartRoot.WriteFile(filediff.NewName, output.Bytes(), os.ModePerm)
-			if err != nil {
-				return fmt.Errorf("error applying patch to %s: %w", filediff.NewName, err)
-			}
+		err := chartRoot.WriteFile(merge.path, merge.data, os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("error merging local changes into %s: %w", merge.path, err)
 		}
 	}
 
 	return nil
 }
+
+// newLocalFiles returns the local files which are not contained in the source chart, but are in directories which
+// exist in it.
+func newLocalFiles(chartRoot *os.Root, sourceChartPaths map[string][]string) ([]string, error) {
+	var ret []string
+	err := fs.WalkDir(chartRoot.FS(), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if strings.Contains(p, "/") {
+			sdir := path.Dir(p)
+			if sp, ok := sourceChartPaths[sdir]; ok {
+				if !slices.Contains(sp, p) {
+					ret = append(ret, p)
+				}
+			}
+		}
+		return nil
+	})
+	return ret, err
+}
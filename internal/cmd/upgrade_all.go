@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rrgmc/helm-vendor/internal/config"
+)
+
+func (c *Cmd) UpgradeAll(ctx context.Context, options UpgradeOptions) error {
+	type summaryItem struct {
+		path   string
+		result upgradeResult
+		err    error
+	}
+
+	var charts []config.Chart
+	for _, chartConfig := range c.cfg.Charts {
+		if !c.chartRootFileExists(chartConfig) {
+			continue
+		}
+		charts = append(charts, chartConfig)
+	}
+
+	summary := make([]summaryItem, len(charts))
+	var errs []error
+
+	chartErrs := c.forEachChart(ctx, charts, func(ctx context.Context, index int, chartConfig config.Chart, out io.Writer) error {
+		result, err := c.upgradeChart(ctx, chartConfig, "", options, true, out)
+		if err != nil {
+			_, _ = fmt.Fprintf(out, "error upgrading chart %s: %s\n", chartConfig.Path, err)
+		}
+		summary[index].result = result
+		return err
+	})
+	for i, chartConfig := range charts {
+		summary[i].path = chartConfig.Path
+		summary[i].err = chartErrs[i]
+		if chartErrs[i] != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", chartConfig.Path, chartErrs[i]))
+		}
+	}
+
+	fmt.Printf("Upgrade summary:\n")
+	for _, item := range summary {
+		switch {
+		case item.err != nil:
+			fmt.Printf("! %s: error: %s\n", item.path, item.err)
+		case item.result.upToDate:
+			fmt.Printf("- %s: [%s] up to date\n", item.path, item.result.currentVersion)
+		case options.DryRun:
+			fmt.Printf("- %s: [%s => %s] would upgrade\n", item.path, item.result.currentVersion, item.result.newVersion)
+		default:
+			fmt.Printf("- %s: [%s => %s] upgraded\n", item.path, item.result.currentVersion, item.result.newVersion)
+		}
+		for _, p := range item.result.orphaned {
+			fmt.Printf("\t- orphaned (removed upstream, modified locally, %s): %s\n", options.Orphaned, p)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+
+	"github.com/rrgmc/helm-vendor/internal/config"
+	"github.com/rrgmc/helm-vendor/internal/diff"
+	"github.com/rrgmc/helm-vendor/internal/file"
+	"github.com/rrgmc/helm-vendor/internal/helm"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// upgradePlan is the list of changes an upgrade will do to the local chart files. It is built without changing
+// anything on disk.
+type upgradePlan struct {
+	// sourceFiles are the files from the source chart, which are deleted locally before copying the new version.
+	sourceFiles []string
+	// latestFiles are the files from the new chart version, which are copied to the local folder.
+	latestFiles []string
+	// removed are the local files which will be deleted and don't exist in the new version.
+	removed []string
+	// orphaned are the local files which don't exist in the new version, but have local changes. They are handled by
+	// the orphan policy instead of being deleted.
+	orphaned []string
+	// added are the files of the new version which don't exist locally.
+	added []string
+	// overwritten are the files of the new version which will overwrite an existing local file.
+	overwritten []string
+	// diff is the diff between the source chart and the local files.
+	diff *diff.Builder
+	// merges is the result of merging the local changes into the new version files.
+	merges []upgradeMerge
+}
+
+// upgradeMerge is the three-way merge of the source chart file, the local file and the new version file.
+type upgradeMerge struct {
+	path string
+	data []byte
+	// conflicts is the number of conflicting changes, which are marked in data.
+	conflicts int
+	// removed is whether the file was removed locally, and is unchanged in the new version.
+	removed bool
+	// binary is whether the file is binary, which isn't merged, and data is the local copy.
+	binary bool
+}
+
+func newUpgradePlan(chartRoot *os.Root, sourceChartFiles, latestChartFiles *helm.ChartFiles,
+	chartFileIter func(iter file.Iter) file.Iter, mergeChanges bool, binaryPolicy BinaryPolicy) (*upgradePlan, error) {
+	plan := &upgradePlan{
+		diff: diff.NewBuilder(sourceChartFiles != nil),
+	}
+
+	sourceFiles := map[string]bool{}
+	var localFiles []string
+
+	if sourceChartFiles != nil {
+		changes, err := newLocalChanges(chartRoot, sourceChartFiles, chartFileIter)
+		if err != nil {
+			return nil, err
+		}
+		plan.diff = changes.diff
+		plan.sourceFiles = changes.sourceFiles
+		localFiles = changes.localFiles
+		for _, p := range plan.sourceFiles {
+			sourceFiles[p] = true
+		}
+	}
+
+	latestFiles := map[string]bool{}
+
+	for fi, err := range chartFileIter(latestChartFiles.Iter()) {
+		if err != nil {
+			return nil, err
+		}
+		if fi.Entry.IsDir() {
+			continue
+		}
+
+		plan.latestFiles = append(plan.latestFiles, fi.Path)
+		latestFiles[fi.Path] = true
+
+		if file.Exists(chartRoot, fi.Path) {
+			plan.overwritten = append(plan.overwritten, fi.Path)
+		} else {
+			plan.added = append(plan.added, fi.Path)
+		}
+	}
+
+	for _, p := range plan.sourceFiles {
+		if latestFiles[p] || !file.Exists(chartRoot, p) {
+			continue
+		}
+		localData, err := chartRoot.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		sourceData, err := sourceChartFiles.Root().ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(localData, sourceData) {
+			plan.removed = append(plan.removed, p)
+		} else {
+			plan.orphaned = append(plan.orphaned, p)
+		}
+	}
+
+	if binaryPolicy != BinaryPolicyLocal && (!mergeChanges || plan.diff.IsEmpty()) {
+		return plan, nil
+	}
+
+	// merge the local changes into the new version files in memory, keeping the local copy of binary files if
+	// requested. The binary policy also applies to the other local files which the new version overwrites.
+	latestChart := latestChartFiles.Chart().Chart()
+	upstreamLabel := fmt.Sprintf("%s %s", latestChart.Name, helm.GetChartVersion(latestChart))
+
+	mergeFiles := slices.Concat(plan.sourceFiles, localFiles)
+	for _, p := range plan.overwritten {
+		if !slices.Contains(mergeFiles, p) {
+			mergeFiles = append(mergeFiles, p)
+		}
+	}
+
+	for _, p := range mergeFiles {
+		var baseData []byte
+		if sourceFiles[p] {
+			var err error
+			baseData, err = sourceChartFiles.Root().ReadFile(p)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		localData, err := chartRoot.ReadFile(p)
+		localExists := err == nil
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		if !latestFiles[p] {
+			// new local files are kept as they are, and files removed in the new version are deleted or orphaned.
+			continue
+		}
+		if sourceFiles[p] && localExists && bytes.Equal(baseData, localData) {
+			continue
+		}
+
+		latestData, err := latestChartFiles.Root().ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		if diff.IsBinary(baseData) || diff.IsBinary(localData) || diff.IsBinary(latestData) {
+			// binary files can't be merged, the upstream copy is kept unless the policy is to keep the local one.
+			if binaryPolicy == BinaryPolicyLocal && (!localExists || !bytes.Equal(localData, latestData)) {
+				plan.merges = append(plan.merges, upgradeMerge{path: p, data: localData, removed: !localExists,
+					binary: true})
+			}
+			continue
+		}
+		if !mergeChanges || plan.diff.IsEmpty() || (!sourceFiles[p] && !slices.Contains(localFiles, p)) {
+			// local files unknown to the source chart, other than the new local files, are overwritten.
+			continue
+		}
+
+		merge := upgradeMerge{path: p}
+		if sourceFiles[p] && !localExists && bytes.Equal(baseData, latestData) {
+			merge.removed = true
+		} else {
+			merge.data, merge.conflicts = diff.Merge3(baseData, localData, latestData, "local", upstreamLabel)
+		}
+		plan.merges = append(plan.merges, merge)
+	}
+
+	return plan, nil
+}
+
+func (p *upgradePlan) print(out io.Writer, chartConfig config.Chart, currentChart, latestChart *repo.ChartVersion,
+	orphanPolicy OrphanPolicy) {
+	_, _ = fmt.Fprintf(out, "Upgrade plan for '%s' [%s => %s]:\n", chartConfig.Path, helm.GetChartVersion(currentChart),
+		helm.GetChartVersion(latestChart))
+
+	printList := func(title string, list []string) {
+		_, _ = fmt.Fprintf(out, "- %s: %d\n", title, len(list))
+		for _, item := range list {
+			_, _ = fmt.Fprintf(out, "\t- %s\n", item)
+		}
+	}
+
+	printList("removed", p.removed)
+	printList("added", p.added)
+	printList("overwritten", p.overwritten)
+	printList(fmt.Sprintf("orphaned (removed upstream, modified locally, %s)", orphanPolicy), p.orphaned)
+
+	if !p.diff.IsEmpty() {
+		_, _ = fmt.Fprintf(out, "- local changes diff:\n%s", p.diff.String())
+	} else {
+		_, _ = fmt.Fprintf(out, "- local changes diff: none\n")
+	}
+
+	if len(p.merges) > 0 {
+		_, _ = fmt.Fprintf(out, "- merges:\n")
+		for _, merge := range p.merges {
+			switch {
+			case merge.removed:
+				_, _ = fmt.Fprintf(out, "\t- %s: removed locally\n", merge.path)
+			case merge.binary:
+				_, _ = fmt.Fprintf(out, "\t- %s: binary, keeping the local copy\n", merge.path)
+			case merge.conflicts > 0:
+				_, _ = fmt.Fprintf(out, "\t- %s: %d conflict(s)\n", merge.path, merge.conflicts)
+			default:
+				_, _ = fmt.Fprintf(out, "\t- %s: merges cleanly\n", merge.path)
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rrgmc/helm-vendor/internal/config"
+	"github.com/rrgmc/helm-vendor/internal/file"
+	"github.com/rrgmc/helm-vendor/internal/helm"
+)
+
+// writeTestFiles writes the files to the dir folder, creating it.
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// downloadTestChart returns the chart files of a local chart folder with the files.
+func downloadTestChart(t *testing.T, files map[string]string) *helm.ChartFiles {
+	t.Helper()
+	dir := t.TempDir()
+	writeTestFiles(t, dir, files)
+
+	repository, err := helm.LoadLocalRepository("file://"+dir, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chart, err := repository.GetChart("demo", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chartFiles, err := chart.Download()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = chartFiles.Close()
+	})
+	return chartFiles
+}
+
+func TestUpgradeBinaryLocalWithoutApplyPatch(t *testing.T) {
+	source := map[string]string{
+		"Chart.yaml":     "apiVersion: v2\nname: demo\nversion: 1.0.0\n",
+		"values.yaml":    "a: 1\n",
+		"files/logo.png": "\x00logo 1",
+	}
+	latest := map[string]string{
+		"Chart.yaml":     "apiVersion: v2\nname: demo\nversion: 2.0.0\n",
+		"values.yaml":    "a: 2\n",
+		"files/logo.png": "\x00logo 2",
+		"notes.txt":      "upstream notes\n",
+		"icon.png":       "\x00upstream icon",
+	}
+	// the local chart has no changes to the source chart files, and has local files which the new version adds.
+	local := map[string]string{
+		"notes.txt": "local notes\n",
+		"icon.png":  "\x00local icon",
+	}
+	for name, data := range source {
+		local[name] = data
+	}
+
+	chartDir := t.TempDir()
+	writeTestFiles(t, chartDir, local)
+	chartRoot, err := os.OpenRoot(chartDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chartRoot.Close()
+
+	sourceChartFiles := downloadTestChart(t, source)
+	latestChartFiles := downloadTestChart(t, latest)
+	chartFileIter := func(iter file.Iter) file.Iter {
+		return iter
+	}
+
+	plan, err := newUpgradePlan(chartRoot, sourceChartFiles, latestChartFiles, chartFileIter, false,
+		BinaryPolicyLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.diff.IsEmpty() {
+		t.Fatalf("local changes diff is not empty:\n%s", plan.diff.String())
+	}
+	if len(plan.merges) != 1 || plan.merges[0].path != "icon.png" || !plan.merges[0].binary {
+		t.Fatalf("merges = %+v, want only the local copy of icon.png", plan.merges)
+	}
+
+	c := &Cmd{}
+	err = c.applyUpgradePlan(io.Discard, config.Chart{Path: "demo"}, sourceChartFiles.Chart().Chart(), plan,
+		OrphanPolicyMove, chartRoot, latestChartFiles, map[string]string{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"Chart.yaml":     latest["Chart.yaml"],
+		"values.yaml":    latest["values.yaml"],
+		"files/logo.png": latest["files/logo.png"],
+		"notes.txt":      latest["notes.txt"],
+		"icon.png":       local["icon.png"],
+	}
+	for name, data := range want {
+		got, err := chartRoot.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != data {
+			t.Errorf("%s = %q, want %q", name, got, data)
+		}
+	}
+}
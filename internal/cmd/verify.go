@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rrgmc/helm-vendor/internal/config"
+	"github.com/rrgmc/helm-vendor/internal/file"
+	"github.com/rrgmc/helm-vendor/internal/helm"
+)
+
+var ErrDrift = errors.New("vendored files differ from the upstream chart")
+
+func (c *Cmd) Verify(ctx context.Context, path string) error {
+	for _, chartConfig := range c.cfg.Charts {
+		if path == chartConfig.Path {
+			drift, err := c.verifyChart(ctx, chartConfig)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if drift {
+				return ErrDrift
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown path '%s'", path)
+}
+
+func (c *Cmd) VerifyAll(ctx context.Context) error {
+	var hasDrift, hasError bool
+	for _, chartConfig := range c.cfg.Charts {
+		if !c.chartRootExists(chartConfig) {
+			fmt.Printf("! %s: not found\n", chartConfig.Path)
+			continue
+		}
+		drift, err := c.verifyChart(ctx, chartConfig)
+		if err != nil {
+			fmt.Printf("! %s: error verifying: %s\n", chartConfig.Path, err)
+			hasError = true
+		}
+		if drift {
+			hasDrift = true
+		}
+	}
+	if hasError {
+		return errors.New("errors verifying charts")
+	}
+	if hasDrift {
+		return ErrDrift
+	}
+	return nil
+}
+
+// verifyChart compares the vendored files with the upstream chart of the same version, returning whether there is
+// any drift.
+func (c *Cmd) verifyChart(ctx context.Context, chartConfig config.Chart) (bool, error) {
+	chartRoot, err := c.openChartRoot(chartConfig)
+	if err != nil {
+		return false, err
+	}
+	defer chartRoot.Close()
+
+	currentChart, err := c.currentChartVersion(chartConfig, chartRoot)
+	if err != nil {
+		return false, err
+	}
+	if currentChart == nil {
+		return false, fmt.Errorf("chart not found in path '%s'", chartConfig.Path)
+	}
+
+	repo, err := c.loadRepository(ctx, chartConfig)
+	if err != nil {
+		return false, err
+	}
+
+	sourceChart, err := repo.GetLockedChart(currentChart.Name, currentChart.Version, currentChart.Digest)
+	if err != nil {
+		return false, err
+	}
+
+	sourceChartFiles, err := sourceChart.Download(c.chartDownloadOptions(ctx, chartConfig)...)
+	if err != nil {
+		return false, err
+	}
+	defer sourceChartFiles.Close()
+
+	// the vendored files are expected to have the chart patches applied. Patches which failed to apply to the local
+	// version are reported as changes.
+	err = c.applyPatches(chartConfig, sourceChartFiles, io.Discard)
+	if err != nil && !errors.Is(err, ErrPatchFailed) {
+		return false, err
+	}
+
+	chartFileIter := func(iter file.Iter) file.Iter {
+		return file.IterFilter(iter, file.Filter{
+			Ignore: chartConfig.Files.Ignore,
+		})
+	}
+
+	var modified, deleted []string
+	sourceFiles := map[string]bool{}
+
+	for fi, err := range chartFileIter(sourceChartFiles.Iter()) {
+		if err != nil {
+			return false, err
+		}
+		if fi.Entry.IsDir() {
+			continue
+		}
+
+		sourceFiles[fi.Path] = true
+
+		localData, err := chartRoot.ReadFile(fi.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			deleted = append(deleted, fi.Path)
+			continue
+		} else if err != nil {
+			return false, err
+		}
+
+		sourceData, err := sourceChartFiles.Root().ReadFile(fi.Path)
+		if err != nil {
+			return false, err
+		}
+
+		if !bytes.Equal(localData, sourceData) {
+			modified = append(modified, fi.Path)
+		}
+	}
+
+	added, err := addedLocalFiles(chartRoot, sourceFiles, chartFileIter)
+	if err != nil {
+		return false, err
+	}
+
+	if len(modified) == 0 && len(deleted) == 0 && len(added) == 0 {
+		fmt.Printf("- %s: [%s] no changes\n", chartConfig.Path, helm.GetChartVersion(currentChart))
+		return false, nil
+	}
+
+	fmt.Printf("- %s: [%s] changed\n", chartConfig.Path, helm.GetChartVersion(currentChart))
+	for _, p := range modified {
+		fmt.Printf("\t- modified: %s\n", p)
+	}
+	for _, p := range deleted {
+		fmt.Printf("\t- deleted: %s\n", p)
+	}
+	for _, p := range added {
+		fmt.Printf("\t- added: %s\n", p)
+	}
+
+	return true, nil
+}
+
+// addedLocalFiles returns all local files which are not contained in the source chart, except the files written by
+// upgrade, which are the local changes diff files and the orphaned files.
+func addedLocalFiles(chartRoot *os.Root, sourceFiles map[string]bool,
+	chartFileIter func(iter file.Iter) file.Iter) ([]string, error) {
+	var ret []string
+	for fi, err := range chartFileIter(file.IterDir(chartRoot.FS(), ".")) {
+		if err != nil {
+			return nil, err
+		}
+		if fi.Entry.IsDir() || sourceFiles[fi.Path] || isUpgradeOutputFile(fi.Path) {
+			continue
+		}
+		ret = append(ret, fi.Path)
+	}
+	return ret, nil
+}
+
+// isUpgradeOutputFile returns whether the file was written by upgrade, and is not a chart file.
+func isUpgradeOutputFile(p string) bool {
+	if strings.HasPrefix(p, orphanedPath+"/") {
+		return true
+	}
+	match, _ := path.Match("helm-vendor-*.diff", p)
+	return match
+}
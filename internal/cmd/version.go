@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/rrgmc/helm-vendor/internal/config"
+	"github.com/rrgmc/helm-vendor/internal/helm"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// VersionPolicy restricts which newer versions are considered when looking for the latest version of a chart.
+type VersionPolicy string
+
+const (
+	// VersionPolicyLatest allows any newer version.
+	VersionPolicyLatest VersionPolicy = "latest"
+	// VersionPolicyMinor allows only newer versions with the same major version.
+	VersionPolicyMinor VersionPolicy = "minor"
+	// VersionPolicyPatch allows only newer versions with the same major and minor version.
+	VersionPolicyPatch VersionPolicy = "patch"
+)
+
+func ParseVersionPolicy(policy string) (VersionPolicy, error) {
+	switch VersionPolicy(policy) {
+	case "", VersionPolicyLatest:
+		return VersionPolicyLatest, nil
+	case VersionPolicyMinor, VersionPolicyPatch:
+		return VersionPolicy(policy), nil
+	default:
+		return "", fmt.Errorf("invalid version policy '%s'", policy)
+	}
+}
+
+// matcher returns a function which checks if a version is allowed by the policy, relative to the current version.
+func (p VersionPolicy) matcher(currentVersion string) (func(version *semver.Version) bool, error) {
+	if p == "" || p == VersionPolicyLatest {
+		return func(version *semver.Version) bool {
+			return true
+		}, nil
+	}
+
+	current, err := semver.NewVersion(currentVersion)
+	if err != nil {
+		return nil, fmt.Errorf("cannot apply version policy '%s' to current version '%s': %w", p, currentVersion, err)
+	}
+
+	return func(version *semver.Version) bool {
+		switch p {
+		case VersionPolicyMinor:
+			return version.Major() == current.Major()
+		case VersionPolicyPatch:
+			return version.Major() == current.Major() && version.Minor() == current.Minor()
+		}
+		return false
+	}, nil
+}
+
+// prereleaseConstraintMatcher returns a matcher for the constraint which also accepts pre-releases, checking them
+// as the version they are a pre-release of. Constraints which include a pre-release are checked as is.
+func prereleaseConstraintMatcher(constraint *semver.Constraints) func(version *semver.Version) bool {
+	return func(version *semver.Version) bool {
+		if constraint.Check(version) {
+			return true
+		}
+		if version.Prerelease() == "" {
+			return false
+		}
+		release, err := version.SetPrerelease("")
+		if err != nil {
+			return false
+		}
+		return constraint.Check(&release)
+	}
+}
+
+// resolveChart returns the chart to use for the passed version. If version is blank, the highest version matching
+// the chart version constraint and allowed by the policy in relation to the current version is returned.
+// Pre-release versions are only returned if allowed by the chart configuration or the command line.
+func (c *Cmd) resolveChart(repository *helm.Repository, chartConfig config.Chart, version string,
+	currentChart *repo.ChartVersion, policy VersionPolicy) (*helm.Chart, error) {
+	if version != "" {
+		return repository.GetChart(chartConfig.Name, version)
+	}
+
+	includePrerelease := c.includePrerelease || chartConfig.AllowPrerelease
+	usePolicy := currentChart != nil && policy != "" && policy != VersionPolicyLatest
+
+	if chartConfig.Version == "" && !includePrerelease && !usePolicy {
+		// the default latest version skips pre-releases.
+		return repository.GetChart(chartConfig.Name, "")
+	}
+
+	var matchers []func(version *semver.Version) bool
+
+	if !includePrerelease {
+		matchers = append(matchers, func(version *semver.Version) bool {
+			return version.Prerelease() == ""
+		})
+	}
+
+	if chartConfig.Version != "" {
+		constraint, err := semver.NewConstraint(chartConfig.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint '%s': %w", chartConfig.Version, err)
+		}
+		if includePrerelease {
+			matchers = append(matchers, prereleaseConstraintMatcher(constraint))
+		} else {
+			matchers = append(matchers, constraint.Check)
+		}
+	}
+
+	if usePolicy {
+		match, err := policy.matcher(currentChart.Version)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, match)
+	}
+
+	return repository.GetChartMatching(chartConfig.Name, func(version *semver.Version) bool {
+		for _, match := range matchers {
+			if !match(version) {
+				return false
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rrgmc/helm-vendor/internal/config"
+	"github.com/rrgmc/helm-vendor/internal/helm"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// newTestRepository serves a repository index file with the versions of the "demo" chart.
+func newTestRepository(t *testing.T, versions ...string) *helm.Repository {
+	t.Helper()
+
+	var index strings.Builder
+	index.WriteString("apiVersion: v1\nentries:\n  demo:\n")
+	for _, version := range versions {
+		_, _ = fmt.Fprintf(&index, "    - apiVersion: v2\n      name: demo\n      version: %s\n"+
+			"      urls:\n        - demo-%s.tgz\n", version, version)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(index.String()))
+	}))
+	t.Cleanup(server.Close)
+
+	repository, err := helm.LoadRepository(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repository
+}
+
+func TestResolveChart(t *testing.T) {
+	repository := newTestRepository(t, "1.0.0", "1.0.1", "1.1.0", "1.2.0-rc.1", "2.0.0", "2.1.0-beta.1")
+
+	tests := []struct {
+		name              string
+		version           string
+		constraint        string
+		allowPrerelease   bool
+		includePrerelease bool
+		currentVersion    string
+		policy            VersionPolicy
+		want              string
+		wantErr           bool
+	}{
+		{name: "latest", want: "2.0.0"},
+		{name: "explicit version", version: "1.1.0", want: "1.1.0"},
+		{name: "explicit pre-release version", version: "1.2.0-rc.1", want: "1.2.0-rc.1"},
+		{name: "explicit version outside constraint", version: "2.0.0", constraint: "~1.1", want: "2.0.0"},
+		{name: "tilde constraint", constraint: "~1.1", want: "1.1.0"},
+		{name: "caret constraint skips pre-releases", constraint: "^1", want: "1.1.0"},
+		{name: "range constraint", constraint: ">=1.0.0 <1.1.0", want: "1.0.1"},
+		{name: "constraint without match", constraint: "~3", wantErr: true},
+		{name: "allow pre-release", allowPrerelease: true, want: "2.1.0-beta.1"},
+		{name: "include pre-release", includePrerelease: true, want: "2.1.0-beta.1"},
+		{name: "constraint with pre-release", constraint: "^1", allowPrerelease: true, want: "1.2.0-rc.1"},
+		{name: "latest policy", currentVersion: "1.0.0", policy: VersionPolicyLatest, want: "2.0.0"},
+		{name: "minor policy", currentVersion: "1.0.0", policy: VersionPolicyMinor, want: "1.1.0"},
+		{name: "patch policy", currentVersion: "1.0.0", policy: VersionPolicyPatch, want: "1.0.1"},
+		{name: "policy without current version", policy: VersionPolicyPatch, want: "2.0.0"},
+		{name: "policy and constraint", currentVersion: "1.0.0", policy: VersionPolicyMinor, constraint: "<1.1",
+			want: "1.0.1"},
+		{name: "minor policy with pre-release", currentVersion: "1.0.0", policy: VersionPolicyMinor,
+			allowPrerelease: true, want: "1.2.0-rc.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Cmd{includePrerelease: tt.includePrerelease}
+			chartConfig := config.Chart{
+				Name:            "demo",
+				Version:         tt.constraint,
+				AllowPrerelease: tt.allowPrerelease,
+			}
+			var currentChart *repo.ChartVersion
+			if tt.currentVersion != "" {
+				currentChart = &repo.ChartVersion{Metadata: &chart.Metadata{Name: "demo", Version: tt.currentVersion}}
+			}
+
+			got, err := c.resolveChart(repository, chartConfig, tt.version, currentChart, tt.policy)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolveChart() = %s, want an error", got.Chart().Version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Chart().Version != tt.want {
+				t.Errorf("resolveChart() = %s, want %s", got.Chart().Version, tt.want)
+			}
+		})
+	}
+}
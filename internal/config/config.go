@@ -16,11 +16,47 @@ type Chart struct {
 	Path       string     `yaml:"path"`
 	Repository Repository `yaml:"repository"`
 	Name       string     `yaml:"name"`
-	Files      Files      `yaml:"files"`
+	Version    string     `yaml:"version"`
+	// AllowPrerelease allows pre-release versions to be used as the latest version.
+	AllowPrerelease bool `yaml:"allowPrerelease"`
+	// Verify requires the chart archive to have a provenance file, signed by a key in the keyring.
+	Verify bool `yaml:"verify"`
+	// Keyring is the keyring file used to verify the chart. The default is the same as the Helm command line.
+	Keyring string `yaml:"keyring"`
+	// Patches is a folder with patch files applied to each fetched or upgraded version, in the order of its "series"
+	// file, or by file name if there isn't one.
+	Patches string `yaml:"patches"`
+	Files   Files  `yaml:"files"`
 }
 
 type Repository struct {
+	// Name is the name of a repository from Helm's repositories file, added with "helm repo add".
+	Name      string        `yaml:"name"`
+	URL       string        `yaml:"url"`
+	Username  Value         `yaml:"username"`
+	Password  Value         `yaml:"password"`
+	Token     Value         `yaml:"token"`
+	TLS       RepositoryTLS `yaml:"tls"`
+	PlainHTTP bool          `yaml:"plainHTTP"`
+	// Git is a Git repository containing the chart, used instead of a Helm repository.
+	Git RepositoryGit `yaml:"git"`
+}
+
+type RepositoryTLS struct {
+	CertFile           string `yaml:"certFile"`
+	KeyFile            string `yaml:"keyFile"`
+	CAFile             string `yaml:"caFile"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+type RepositoryGit struct {
 	URL string `yaml:"url"`
+	// Ref is a fixed branch, tag or commit, used instead of listing the versions from the tags.
+	Ref string `yaml:"ref"`
+	// TagPattern selects the tags which are chart versions, with "*" as the version placeholder, like "v*".
+	TagPattern string `yaml:"tagPattern"`
+	// Path is the chart folder inside the repository.
+	Path string `yaml:"path"`
 }
 
 type Files struct {
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Value is a configuration value which can be set as a literal string, or as a reference to an environment
+// variable or a file.
+//
+//	password: literal
+//	password:
+//	  env: REPO_PASSWORD
+//	password:
+//	  file: /run/secrets/repo-password
+type Value struct {
+	Value string `yaml:"value"`
+	Env   string `yaml:"env"`
+	File  string `yaml:"file"`
+}
+
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var literal string
+	if err := json.Unmarshal(data, &literal); err == nil {
+		*v = Value{Value: literal}
+		return nil
+	}
+
+	type value Value
+	var ret value
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&ret); err != nil {
+		return err
+	}
+	*v = Value(ret)
+	return nil
+}
+
+// Resolve returns the value. Relative file names are resolved from basePath.
+func (v Value) Resolve(basePath string) (string, error) {
+	switch {
+	case v.Env != "":
+		ret, ok := os.LookupEnv(v.Env)
+		if !ok {
+			return "", fmt.Errorf("environment variable '%s' is not set", v.Env)
+		}
+		return ret, nil
+	case v.File != "":
+		ret, err := os.ReadFile(ResolvePath(basePath, v.File))
+		if err != nil {
+			return "", fmt.Errorf("error reading value file: %w", err)
+		}
+		return strings.TrimSpace(string(ret)), nil
+	default:
+		return v.Value, nil
+	}
+}
+
+// ResolvePath returns the path relative to basePath if it is not absolute.
+func ResolvePath(basePath string, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(basePath, path)
+}
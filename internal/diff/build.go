@@ -3,8 +3,10 @@ package diff
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
+	"strings"
 
 	"github.com/aymanbagabas/go-udiff"
 )
@@ -12,6 +14,16 @@ import (
 type Builder struct {
 	buffer      bytes.Buffer
 	diffEnabled bool
+	stats       []FileStat
+}
+
+// FileStat is the number of lines added and deleted in a file.
+type FileStat struct {
+	Path    string
+	Added   int
+	Deleted int
+	// Binary is whether the file is binary, in which case lines are not counted.
+	Binary bool
 }
 
 func NewBuilder(diffEnabled bool) *Builder {
@@ -58,6 +70,24 @@ func (b *Builder) AddData(sourcePath, destPath string, sourceFileData, destFileD
 		return nil
 	}
 
+	// binary files can't be diffed, only marked as changed as done by git
+	if IsBinary(sourceFileData) || IsBinary(destFileData) {
+		if bytes.Equal(sourceFileData, destFileData) {
+			return nil
+		}
+		sourceName, destName := "a/"+sourcePath, "b/"+destPath
+		if len(sourceFileData) == 0 {
+			sourceName = "/dev/null"
+		}
+		if len(destFileData) == 0 {
+			destName = "/dev/null"
+		}
+		_, _ = fmt.Fprintf(&b.buffer, "diff --git a/%s b/%s\nBinary files %s and %s differ\n", sourcePath, destPath,
+			sourceName, destName)
+		b.stats = append(b.stats, FileStat{Path: destPath, Binary: true})
+		return nil
+	}
+
 	// get a diff of the files
 	edits := udiff.Bytes(sourceFileData, destFileData)
 	if len(edits) > 0 {
@@ -67,12 +97,18 @@ func (b *Builder) AddData(sourcePath, destPath string, sourceFileData, destFileD
 		}
 		if diffstr != "" {
 			_, _ = b.buffer.WriteString(diffstr)
+			b.stats = append(b.stats, diffStat(destPath, diffstr))
 		}
 	}
 
 	return nil
 }
 
+// Stats returns the number of lines added and deleted in each file, in the diff order.
+func (b *Builder) Stats() []FileStat {
+	return b.stats
+}
+
 func (b *Builder) IsEmpty() bool {
 	return b.buffer.Len() == 0
 }
@@ -84,3 +120,26 @@ func (b *Builder) Bytes() []byte {
 func (b *Builder) String() string {
 	return b.buffer.String()
 }
+
+// IsBinary returns whether the data is from a binary file, if it has a NUL byte in the first 8000 bytes, as done by
+// git.
+func IsBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
+
+// diffStat counts the lines added and deleted in the unified diff of a file, skipping the file header.
+func diffStat(path string, diffstr string) FileStat {
+	stat := FileStat{Path: path}
+	for i, line := range strings.Split(diffstr, "\n") {
+		if i < 2 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "+"):
+			stat.Added++
+		case strings.HasPrefix(line, "-"):
+			stat.Deleted++
+		}
+	}
+	return stat
+}
@@ -0,0 +1,56 @@
+package diff
+
+import (
+	"strings"
+)
+
+const (
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+// Color adds terminal colors to a unified diff, as done by git: file headers in bold, hunk headers in cyan, added
+// lines in green and deleted lines in red.
+func Color(diffstr string) string {
+	lines := strings.SplitAfter(diffstr, "\n")
+	var b strings.Builder
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		content, eol := strings.CutSuffix(line, "\n")
+		var color string
+		switch {
+		case strings.HasPrefix(content, "diff --git "), strings.HasPrefix(content, "--- "),
+			strings.HasPrefix(content, "+++ "):
+			color = colorBold
+		case strings.HasPrefix(content, "@@"):
+			color = colorCyan
+		case strings.HasPrefix(content, "+"):
+			color = colorGreen
+		case strings.HasPrefix(content, "-"):
+			color = colorRed
+		}
+		if color != "" {
+			content = color + content + colorReset
+		}
+		_, _ = b.WriteString(content)
+		if eol {
+			_ = b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// ColorAdded returns the text in the color of added lines.
+func ColorAdded(s string) string {
+	return colorGreen + s + colorReset
+}
+
+// ColorDeleted returns the text in the color of deleted lines.
+func ColorDeleted(s string) string {
+	return colorRed + s + colorReset
+}
@@ -0,0 +1,153 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/aymanbagabas/go-udiff/lcs"
+)
+
+// Merge3 does a three-way merge, line by line, of the local and upstream changes to base. Changes from both sides to
+// the same lines are written as git-style conflict markers, labelled with localLabel and upstreamLabel. Returns the
+// merged data and the number of conflicts.
+func Merge3(base, local, upstream []byte, localLabel, upstreamLabel string) ([]byte, int) {
+	baseLines, localLines, upstreamLines := splitLines(base), splitLines(local), splitLines(upstream)
+	localHunks := lineHunks(baseLines, localLines)
+	upstreamHunks := lineHunks(baseLines, upstreamLines)
+
+	var (
+		out       bytes.Buffer
+		conflicts int
+		pos       int
+	)
+	for len(localHunks) > 0 || len(upstreamHunks) > 0 {
+		// start a region with the first hunk from either side, and extend it while the next hunks overlap it.
+		var regionLocal, regionUpstream []hunk
+		start, end := -1, -1
+		for len(localHunks) > 0 || len(upstreamHunks) > 0 {
+			isLocal := len(upstreamHunks) == 0 ||
+				(len(localHunks) > 0 && localHunks[0].start <= upstreamHunks[0].start)
+			next := upstreamHunks
+			if isLocal {
+				next = localHunks
+			}
+			if start >= 0 && !next[0].overlaps(start, end) {
+				break
+			}
+			if start < 0 {
+				start, end = next[0].start, next[0].end
+			}
+			end = max(end, next[0].end)
+			if isLocal {
+				regionLocal = append(regionLocal, next[0])
+				localHunks = localHunks[1:]
+			} else {
+				regionUpstream = append(regionUpstream, next[0])
+				upstreamHunks = upstreamHunks[1:]
+			}
+		}
+
+		writeLines(&out, baseLines[pos:start])
+		pos = end
+
+		localText := regionText(baseLines, localLines, regionLocal, start, end)
+		upstreamText := regionText(baseLines, upstreamLines, regionUpstream, start, end)
+		switch {
+		case len(regionUpstream) == 0:
+			writeLines(&out, localText)
+		case len(regionLocal) == 0, slices.Equal(localText, upstreamText):
+			writeLines(&out, upstreamText)
+		default:
+			conflicts++
+			_, _ = fmt.Fprintf(&out, "<<<<<<< %s\n", localLabel)
+			writeLines(&out, localText)
+			endLine(&out)
+			_, _ = fmt.Fprintf(&out, "=======\n")
+			writeLines(&out, upstreamText)
+			endLine(&out)
+			_, _ = fmt.Fprintf(&out, ">>>>>>> %s\n", upstreamLabel)
+		}
+	}
+	writeLines(&out, baseLines[pos:])
+
+	return out.Bytes(), conflicts
+}
+
+// hunk is a change of the base lines [start, end) to the lines [replStart, replEnd) of the changed file.
+type hunk struct {
+	start, end         int
+	replStart, replEnd int
+}
+
+// overlaps returns whether the hunk changes any of the base lines [start, end). Insertions at the region boundaries
+// also overlap, as the order of the changes would be ambiguous.
+func (h hunk) overlaps(start, end int) bool {
+	if h.start < end {
+		return true
+	}
+	return h.start == end && (h.start == h.end || start == end)
+}
+
+// lineHunks returns the changes from the base lines to the changed lines.
+func lineHunks(baseLines, changedLines []string) []hunk {
+	// each distinct line is mapped to a rune, to diff the lines as rune slices.
+	ids := map[string]rune{}
+	lineIDs := func(lines []string) []rune {
+		ret := make([]rune, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = rune(len(ids))
+				ids[line] = id
+			}
+			ret[i] = id
+		}
+		return ret
+	}
+
+	var ret []hunk
+	for _, d := range lcs.DiffRunes(lineIDs(baseLines), lineIDs(changedLines)) {
+		ret = append(ret, hunk{start: d.Start, end: d.End, replStart: d.ReplStart, replEnd: d.ReplEnd})
+	}
+	return ret
+}
+
+// regionText returns the changed lines for the base lines [start, end), with the hunks of one side applied.
+func regionText(baseLines, changedLines []string, hunks []hunk, start, end int) []string {
+	var ret []string
+	pos := start
+	for _, h := range hunks {
+		ret = append(ret, baseLines[pos:h.start]...)
+		ret = append(ret, changedLines[h.replStart:h.replEnd]...)
+		pos = h.end
+	}
+	return append(ret, baseLines[pos:end]...)
+}
+
+// splitLines splits the data in lines, keeping the line endings.
+func splitLines(data []byte) []string {
+	var ret []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			i = len(data) - 1
+		}
+		ret = append(ret, string(data[:i+1]))
+		data = data[i+1:]
+	}
+	return ret
+}
+
+func writeLines(out *bytes.Buffer, lines []string) {
+	for _, line := range lines {
+		_, _ = out.WriteString(line)
+	}
+}
+
+// endLine adds a line ending if the data doesn't end with one, so conflict markers start on a new line.
+func endLine(out *bytes.Buffer) {
+	if out.Len() > 0 && out.Bytes()[out.Len()-1] != '\n' {
+		_ = out.WriteByte('\n')
+	}
+}
@@ -0,0 +1,127 @@
+package diff
+
+import "testing"
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name          string
+		base          string
+		local         string
+		upstream      string
+		want          string
+		wantConflicts int
+	}{
+		{
+			name:     "no changes",
+			base:     "a\nb\nc\n",
+			local:    "a\nb\nc\n",
+			upstream: "a\nb\nc\n",
+			want:     "a\nb\nc\n",
+		},
+		{
+			name:     "local change only",
+			base:     "a\nb\nc\n",
+			local:    "a\nB\nc\n",
+			upstream: "a\nb\nc\n",
+			want:     "a\nB\nc\n",
+		},
+		{
+			name:     "upstream change only",
+			base:     "a\nb\nc\n",
+			local:    "a\nb\nc\n",
+			upstream: "a\nb\nC\n",
+			want:     "a\nb\nC\n",
+		},
+		{
+			name:     "non-overlapping edits",
+			base:     "a\nb\nc\nd\ne\n",
+			local:    "A\nb\nc\nd\ne\n",
+			upstream: "a\nb\nc\nd\nE\n",
+			want:     "A\nb\nc\nd\nE\n",
+		},
+		{
+			name:     "identical edits",
+			base:     "a\nb\nc\n",
+			local:    "a\nB\nc\n",
+			upstream: "a\nB\nc\n",
+			want:     "a\nB\nc\n",
+		},
+		{
+			name:          "conflicting edits",
+			base:          "a\nb\nc\n",
+			local:         "a\nlocal\nc\n",
+			upstream:      "a\nupstream\nc\n",
+			want:          "a\n<<<<<<< local\nlocal\n=======\nupstream\n>>>>>>> upstream\nc\n",
+			wantConflicts: 1,
+		},
+		{
+			name:     "local deletion and upstream edit elsewhere",
+			base:     "a\nb\nc\nd\n",
+			local:    "a\nc\nd\n",
+			upstream: "a\nb\nc\nD\n",
+			want:     "a\nc\nD\n",
+		},
+		{
+			name:     "local insertion at EOF",
+			base:     "a\nb\n",
+			local:    "a\nb\nc\n",
+			upstream: "A\nb\n",
+			want:     "A\nb\nc\n",
+		},
+		{
+			name:          "insertions at EOF on both sides",
+			base:          "a\nb\n",
+			local:         "a\nb\nlocal\n",
+			upstream:      "a\nb\nupstream\n",
+			want:          "a\nb\n<<<<<<< local\nlocal\n=======\nupstream\n>>>>>>> upstream\n",
+			wantConflicts: 1,
+		},
+		{
+			name:     "identical insertions at EOF",
+			base:     "a\nb\n",
+			local:    "a\nb\nc\n",
+			upstream: "a\nb\nc\n",
+			want:     "a\nb\nc\n",
+		},
+		{
+			name:     "missing trailing newline kept",
+			base:     "a\nb\nc",
+			local:    "A\nb\nc",
+			upstream: "a\nb\nc",
+			want:     "A\nb\nc",
+		},
+		{
+			name:     "trailing newline added upstream",
+			base:     "a\nb\nc",
+			local:    "A\nb\nc",
+			upstream: "a\nb\nc\n",
+			want:     "A\nb\nc\n",
+		},
+		{
+			name:          "conflict without trailing newline",
+			base:          "a\nb",
+			local:         "a\nlocal",
+			upstream:      "a\nupstream",
+			want:          "a\n<<<<<<< local\nlocal\n=======\nupstream\n>>>>>>> upstream\n",
+			wantConflicts: 1,
+		},
+		{
+			name:     "empty base",
+			base:     "",
+			local:    "",
+			upstream: "a\n",
+			want:     "a\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := Merge3([]byte(tt.base), []byte(tt.local), []byte(tt.upstream), "local", "upstream")
+			if string(got) != tt.want {
+				t.Errorf("Merge3() = %q, want %q", got, tt.want)
+			}
+			if conflicts != tt.wantConflicts {
+				t.Errorf("Merge3() conflicts = %d, want %d", conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
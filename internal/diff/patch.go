@@ -2,8 +2,12 @@ package diff
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"iter"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/bluekeyes/go-gitdiff/gitdiff"
 )
@@ -13,7 +17,7 @@ type Patcher struct {
 }
 
 func NewPatcher(diffBody string) (*Patcher, error) {
-	files, _, err := gitdiff.Parse(bytes.NewBufferString(diffBody))
+	files, _, err := gitdiff.Parse(bytes.NewBufferString(stripPathPrefixes(diffBody)))
 	if err != nil {
 		return nil, fmt.Errorf("error parsing unified diff: %w", err)
 	}
@@ -23,12 +27,125 @@ func NewPatcher(diffBody string) (*Patcher, error) {
 	}, nil
 }
 
-func (p *Patcher) Files() iter.Seq[*gitdiff.File] {
-	return func(yield func(*gitdiff.File) bool) {
-		for _, file := range p.files {
-			if !yield(file) {
-				return
+// stripPathPrefixes removes the "a/" and "b/" path prefixes from the file headers of unified diffs not generated by
+// git, like "--- a/values.yaml" and "+++ b/values.yaml", as done by "patch -p1". The parser already removes them from
+// git diffs.
+func stripPathPrefixes(diffBody string) string {
+	lines := strings.SplitAfter(diffBody, "\n")
+	isGit := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, "diff --git ") {
+			isGit = true
+			continue
+		}
+		if strings.HasPrefix(line, "Binary files ") || strings.HasPrefix(line, "GIT binary patch") {
+			// git diffs of binary files have no file headers.
+			isGit = false
+			continue
+		}
+		// file headers are detected as done by the parser, with the old and new names followed by a fragment header.
+		if i+2 >= len(lines) || !strings.HasPrefix(line, "--- ") || !strings.HasPrefix(lines[i+1], "+++ ") ||
+			!strings.HasPrefix(lines[i+2], "@@ -") {
+			continue
+		}
+		if isGit {
+			isGit = false
+			continue
+		}
+		oldName, oldOk := strings.CutPrefix(line, "--- a/")
+		newName, newOk := strings.CutPrefix(lines[i+1], "+++ b/")
+		oldNull, newNull := strings.HasPrefix(line, "--- /dev/null"), strings.HasPrefix(lines[i+1], "+++ /dev/null")
+		if (oldOk || oldNull) && (newOk || newNull) && (oldOk || newOk) {
+			if oldOk {
+				lines[i] = "--- " + oldName
+			}
+			if newOk {
+				lines[i+1] = "+++ " + newName
+			}
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// Apply applies the patch to the files in root. Files are only changed if the patch applies to all of them. Binary
+// files without patch data, like the "Binary files ... differ" markers written by Builder, can't be applied, and are
+// skipped and returned.
+func (p *Patcher) Apply(root *os.Root) ([]string, error) {
+	type patchedFile struct {
+		data    []byte
+		removed bool
+	}
+	patched := map[string]*patchedFile{}
+	var names, skipped []string
+
+	for _, f := range p.files {
+		if f.IsBinary && f.BinaryFragment == nil {
+			name := f.NewName
+			if name == "" {
+				name = f.OldName
+			}
+			skipped = append(skipped, name)
+			continue
+		}
+
+		var src []byte
+		if !f.IsNew {
+			if pf, ok := patched[f.OldName]; ok {
+				if pf.removed {
+					return nil, fmt.Errorf("%s: %w", f.OldName, fs.ErrNotExist)
+				}
+				src = pf.data
+			} else {
+				var err error
+				src, err = root.ReadFile(f.OldName)
+				if err != nil {
+					return nil, err
+				}
 			}
 		}
+
+		var output bytes.Buffer
+		err := gitdiff.Apply(&output, bytes.NewReader(src), f)
+		if err != nil {
+			name := f.NewName
+			if name == "" {
+				name = f.OldName
+			}
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		if f.IsDelete || f.IsRename {
+			if _, ok := patched[f.OldName]; !ok {
+				names = append(names, f.OldName)
+			}
+			patched[f.OldName] = &patchedFile{removed: true}
+		}
+		if !f.IsDelete {
+			if _, ok := patched[f.NewName]; !ok {
+				names = append(names, f.NewName)
+			}
+			patched[f.NewName] = &patchedFile{data: output.Bytes()}
+		}
 	}
+
+	for _, name := range names {
+		pf := patched[name]
+		if pf.removed {
+			err := root.Remove(name)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			continue
+		}
+		err := root.MkdirAll(filepath.Dir(name), os.ModePerm)
+		if err != nil {
+			return nil, err
+		}
+		err = root.WriteFile(name, pf.data, os.ModePerm)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return skipped, nil
 }
@@ -0,0 +1,149 @@
+package diff
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPatcherApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{
+			name: "no prefix",
+			patch: "--- values.yaml\n+++ values.yaml\n@@ -1,2 +1,2 @@\n a: 1\n-b: 2\n+b: 3\n" +
+				"--- /dev/null\n+++ templates/new.yaml\n@@ -0,0 +1 @@\n+new: true\n",
+		},
+		{
+			name: "a/ b/ prefixes",
+			patch: "--- a/values.yaml\n+++ b/values.yaml\n@@ -1,2 +1,2 @@\n a: 1\n-b: 2\n+b: 3\n" +
+				"--- /dev/null\n+++ b/templates/new.yaml\n@@ -0,0 +1 @@\n+new: true\n",
+		},
+		{
+			name: "git",
+			patch: "diff --git a/values.yaml b/values.yaml\n--- a/values.yaml\n+++ b/values.yaml\n" +
+				"@@ -1,2 +1,2 @@\n a: 1\n-b: 2\n+b: 3\n" +
+				"diff --git a/templates/new.yaml b/templates/new.yaml\nnew file mode 100644\n" +
+				"--- /dev/null\n+++ b/templates/new.yaml\n@@ -0,0 +1 @@\n+new: true\n",
+		},
+		{
+			name: "git and a/ b/ prefixes",
+			patch: "diff --git a/values.yaml b/values.yaml\n--- a/values.yaml\n+++ b/values.yaml\n" +
+				"@@ -1,2 +1,2 @@\n a: 1\n-b: 2\n+b: 3\n" +
+				"--- /dev/null\n+++ b/templates/new.yaml\n@@ -0,0 +1 @@\n+new: true\n",
+		},
+		{
+			name: "binary marker and a/ b/ prefixes",
+			patch: "diff --git a/logo.png b/logo.png\nBinary files a/logo.png and b/logo.png differ\n" +
+				"--- a/values.yaml\n+++ b/values.yaml\n@@ -1,2 +1,2 @@\n a: 1\n-b: 2\n+b: 3\n" +
+				"--- /dev/null\n+++ b/templates/new.yaml\n@@ -0,0 +1 @@\n+new: true\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := os.WriteFile(filepath.Join(dir, "values.yaml"), []byte("a: 1\nb: 2\n"), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root, err := os.OpenRoot(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer root.Close()
+
+			patcher, err := NewPatcher(tt.patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := patcher.Apply(root); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, want := range map[string]string{
+				"values.yaml":        "a: 1\nb: 3\n",
+				"templates/new.yaml": "new: true\n",
+			} {
+				data, err := root.ReadFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != want {
+					t.Errorf("%s = %q, want %q", name, data, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPatcherApplyBuilderDiff(t *testing.T) {
+	base := map[string]string{
+		"values.yaml":      "a: 1\nb: 2\n",
+		"logo.png":         "\x00old",
+		"templates/x.yaml": "x: 1\n",
+	}
+	changed := map[string]string{
+		"values.yaml":      "a: 1\nb: 3\n",
+		"logo.png":         "\x00new",
+		"templates/x.yaml": "x: 2\n",
+		"new.png":          "\x00added",
+	}
+
+	// the diff has text files before and after the binary ones.
+	builder := NewBuilder(true)
+	for _, name := range []string{"values.yaml", "logo.png", "new.png", "templates/x.yaml"} {
+		err := builder.AddData(name, name, []byte(base[name]), []byte(changed[name]))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	for name, data := range base {
+		err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), os.ModePerm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, name), []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+
+	patcher, err := NewPatcher(builder.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped, err := patcher.Apply(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"logo.png", "new.png"}; !slices.Equal(skipped, want) {
+		t.Errorf("skipped = %v, want %v", skipped, want)
+	}
+
+	for name, want := range map[string]string{
+		"values.yaml":      changed["values.yaml"],
+		"templates/x.yaml": changed["templates/x.yaml"],
+		"logo.png":         base["logo.png"],
+	} {
+		data, err := root.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+	if _, err := root.Stat("new.png"); err == nil {
+		t.Error("new.png was created from a binary marker")
+	}
+}
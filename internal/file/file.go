@@ -1,6 +1,8 @@
 package file
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -48,6 +50,65 @@ func CopyFile(srcRoot, dstRoot *os.Root, src, dst string) error {
 	return nil
 }
 
+// Hash returns the sha256 digest of the file contents, in the "sha256:<hex>" format.
+func Hash(root *os.Root, filePath string) (string, error) {
+	f, err := root.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return HashReader(f)
+}
+
+func HashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CopyTree copies all files and directories from srcRoot to dstRoot, keeping file modes and symbolic links.
+func CopyTree(srcRoot, dstRoot *os.Root) error {
+	return fs.WalkDir(srcRoot.FS(), ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return dstRoot.MkdirAll(p, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := srcRoot.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return dstRoot.Symlink(target, p)
+		}
+
+		sourceFile, err := srcRoot.Open(p)
+		if err != nil {
+			return fmt.Errorf("failed to open source file: %w", err)
+		}
+		defer sourceFile.Close()
+
+		destinationFile, err := dstRoot.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return fmt.Errorf("failed to create destination file: %w", err)
+		}
+		defer destinationFile.Close()
+
+		_, err = io.Copy(destinationFile, sourceFile)
+		if err != nil {
+			return fmt.Errorf("failed to copy file content: %w", err)
+		}
+		return nil
+	})
+}
+
 func Exists(root *os.Root, filePath string) bool {
 	_, err := root.Stat(filePath)
 	if err == nil {
@@ -73,7 +134,7 @@ func GenerateUniqueFilename(root *os.Root, dir, baseName, extension string) (str
 		filePath := path.Join(dir, filename)
 
 		_, err := root.Stat(filePath)
-		if errors.Is(err, fs.ErrExist) {
+		if err == nil {
 			continue // File exists, try next iteration
 		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
 			return "", fmt.Errorf("failed to stat file %s: %w", filePath, err)
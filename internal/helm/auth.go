@@ -0,0 +1,216 @@
+package helm
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// RepositoryAuth are the credentials and TLS options used to access a repository.
+type RepositoryAuth struct {
+	Username              string
+	Password              string
+	Token                 string
+	CertFile              string
+	KeyFile               string
+	CAFile                string
+	InsecureSkipTLSVerify bool
+	PlainHTTP             bool
+}
+
+func (a RepositoryAuth) hasTLS() bool {
+	return a.CertFile != "" || a.KeyFile != "" || a.CAFile != "" || a.InsecureSkipTLSVerify
+}
+
+func (a RepositoryAuth) tlsConfig() (*tls.Config, error) {
+	ret := &tls.Config{
+		InsecureSkipVerify: a.InsecureSkipTLSVerify,
+	}
+	if a.CertFile != "" || a.KeyFile != "" {
+		if a.CertFile == "" || a.KeyFile == "" {
+			return nil, errors.New("both certificate and key files must be set")
+		}
+		cert, err := tls.LoadX509KeyPair(a.CertFile, a.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		ret.Certificates = []tls.Certificate{cert}
+	}
+	if a.CAFile != "" {
+		caData, err := os.ReadFile(a.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %w", err)
+		}
+		ret.RootCAs = x509.NewCertPool()
+		if !ret.RootCAs.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", a.CAFile)
+		}
+	}
+	return ret, nil
+}
+
+// applyEntry sets the credentials in the repository entry.
+func (a RepositoryAuth) applyEntry(entry *repo.Entry) {
+	entry.Username = a.Username
+	entry.Password = a.Password
+	entry.CertFile = a.CertFile
+	entry.KeyFile = a.KeyFile
+	entry.CAFile = a.CAFile
+	entry.InsecureSkipTLSverify = a.InsecureSkipTLSVerify
+}
+
+// transport returns an HTTP transport with the TLS options.
+func (a RepositoryAuth) transport() (*http.Transport, error) {
+	transport := &http.Transport{
+		DisableCompression: true,
+		Proxy:              http.ProxyFromEnvironment,
+	}
+	if a.hasTLS() {
+		tlsConf, err := a.tlsConfig()
+		if err != nil {
+			return nil, fmt.Errorf("can't create TLS config for client: %w", err)
+		}
+		transport.TLSClientConfig = tlsConf
+	}
+	return transport, nil
+}
+
+// getters returns the getter providers using the credentials. If no TLS options or token are set, the default
+// getters are returned.
+func (a RepositoryAuth) getters(repoURL string) (getter.Providers, error) {
+	if !a.hasTLS() && a.Token == "" {
+		return allGetters, nil
+	}
+	transport, err := a.transport()
+	if err != nil {
+		return nil, err
+	}
+
+	var httpProvider getter.Provider
+	if a.Token != "" {
+		u, err := url.Parse(repoURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid repository URL: %w", err)
+		}
+		httpProvider = getter.Provider{
+			Schemes: []string{"http", "https"},
+			New: func(options ...getter.Option) (getter.Getter, error) {
+				return &tokenGetter{
+					token:  a.Token,
+					host:   u.Host,
+					client: &http.Client{Transport: transport},
+				}, nil
+			},
+		}
+	} else {
+		httpProvider = getter.Provider{
+			Schemes: []string{"http", "https"},
+			New: func(options ...getter.Option) (getter.Getter, error) {
+				return getter.NewHTTPGetter(append(options, getter.WithTransport(transport))...)
+			},
+		}
+	}
+
+	ret := getter.Providers{httpProvider}
+	for _, provider := range allGetters {
+		if !provider.Provides("http") {
+			ret = append(ret, provider)
+		}
+	}
+	return ret, nil
+}
+
+// downloadOptions returns the getter options to download charts from the repository. Credentials are only sent to
+// the repository host.
+func (a RepositoryAuth) downloadOptions(repoURL, chartURL string) []getter.Option {
+	if a.Username == "" || a.Password == "" {
+		return nil
+	}
+	u1, err1 := url.Parse(repoURL)
+	u2, err2 := url.Parse(chartURL)
+	if err1 != nil || err2 != nil || u1.Scheme != u2.Scheme || u1.Host != u2.Host {
+		return nil
+	}
+	return []getter.Option{getter.WithBasicAuth(a.Username, a.Password)}
+}
+
+// registryOptions returns the registry client options using the credentials.
+func (a RepositoryAuth) registryOptions() ([]registry.ClientOption, error) {
+	// use the credentials stored by "helm registry login"
+	ret := []registry.ClientOption{
+		registry.ClientOptCredentialsFile(settings.RegistryConfig),
+	}
+	if a.PlainHTTP {
+		ret = append(ret, registry.ClientOptPlainHTTP())
+	}
+
+	httpClient := &http.Client{}
+	if a.hasTLS() {
+		tlsConf, err := a.tlsConfig()
+		if err != nil {
+			return nil, fmt.Errorf("can't create TLS config for client: %w", err)
+		}
+		httpClient.Transport = &http.Transport{
+			TLSClientConfig: tlsConf,
+			Proxy:           http.ProxyFromEnvironment,
+		}
+		ret = append(ret, registry.ClientOptHTTPClient(httpClient))
+	}
+
+	switch {
+	case a.Token != "":
+		ret = append(ret, registry.ClientOptAuthorizer(auth.Client{
+			Client: httpClient,
+			Credential: func(_ context.Context, _ string) (auth.Credential, error) {
+				return auth.Credential{AccessToken: a.Token}, nil
+			},
+		}))
+	case a.Username != "" && a.Password != "":
+		ret = append(ret, registry.ClientOptBasicAuth(a.Username, a.Password))
+	}
+
+	return ret, nil
+}
+
+// tokenGetter is an HTTP getter which sends a bearer token to the repository host.
+type tokenGetter struct {
+	token  string
+	host   string
+	client *http.Client
+}
+
+func (g *tokenGetter) Get(href string, _ ...getter.Option) (*bytes.Buffer, error) {
+	req, err := http.NewRequest(http.MethodGet, href, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "helm-vendor")
+	if req.URL.Host == g.host {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s : %s", href, resp.Status)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	_, err = io.Copy(buf, resp.Body)
+	return buf, err
+}
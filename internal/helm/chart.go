@@ -1,15 +1,26 @@
 package helm
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 
+	"github.com/rrgmc/helm-vendor/internal/file"
 	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/registry"
 	"helm.sh/helm/v3/pkg/repo"
 )
 
+// ErrDigestMismatch is returned when a chart archive digest is not the one listed in the repository.
+var ErrDigestMismatch = errors.New("chart archive digest mismatch")
+
 type Chart struct {
 	repository *Repository
 	chart      *repo.ChartVersion
@@ -26,61 +37,356 @@ func (c *Chart) Chart() *repo.ChartVersion {
 	return c.chart
 }
 
-func (c *Chart) Download(options ...ChartDownloadOption) (*ChartFiles, error) {
+func (c *Chart) Download(options ...ChartDownloadOption) (_ *ChartFiles, err error) {
+	optns := chartDownloadOptions{
+		ctx: context.Background(),
+	}
+	for _, opt := range options {
+		opt(&optns)
+	}
+
+	isTempPath := false
+	if optns.downloadPath == "" {
+		optns.downloadPath, err = os.MkdirTemp("", "helm-chart")
+		if err != nil {
+			return nil, fmt.Errorf("unable to create temporary directory for download: %w", err)
+		}
+		isTempPath = true
+		defer func() {
+			if err != nil {
+				_ = os.RemoveAll(optns.downloadPath)
+			}
+		}()
+	} else {
+		err = os.MkdirAll(optns.downloadPath, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create output directory for download: %w", err)
+		}
+	}
+
+	if c.repository.git != nil || (c.repository.local != nil && !c.repository.local.isArchive) {
+		if optns.verify {
+			return nil, errors.New("only chart archives can be verified")
+		}
+		var digest string
+		if c.repository.git != nil {
+			digest, err = c.downloadGit(optns.ctx, optns.downloadPath)
+		} else {
+			digest, err = c.downloadLocal(optns.downloadPath)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return newChartFiles(c, optns.downloadPath, isTempPath, digest, "")
+	}
+
+	var archive chartArchive
+	if c.repository.local != nil {
+		archive, err = c.localArchive(optns)
+	} else {
+		var absoluteChartURL string
+		absoluteChartURL, err = c.absoluteURL()
+		if err != nil {
+			return nil, err
+		}
+		archive, err = c.downloadArchive(absoluteChartURL, optns.downloadPath, optns)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = chartutil.ExpandFile(optns.downloadPath, archive.filename)
+	if err != nil {
+		return nil, fmt.Errorf("error expanding chart: %w", err)
+	}
+
+	if archive.isTempFile {
+		_ = os.Remove(archive.filename)
+		_ = os.Remove(archive.filename + ".prov")
+		// if err != nil {
+		// 	return nil, fmt.Errorf("error removing chart temporary file: %w", err)
+		// }
+	}
+
+	return newChartFiles(c, optns.downloadPath, isTempPath, archive.digest, archive.signedBy)
+}
+
+// Prefetch downloads the chart archive to the cache, if not already cached.
+func (c *Chart) Prefetch(options ...ChartDownloadOption) error {
 	var optns chartDownloadOptions
 	for _, opt := range options {
 		opt(&optns)
 	}
 
-	var chartURL string
+	if c.repository.cache == nil {
+		return errors.New("prefetch requires the cache")
+	}
+	if c.repository.git != nil {
+		return errors.New("charts from git repositories cannot be cached")
+	}
+	if c.repository.local != nil {
+		// local charts don't need to be cached
+		return nil
+	}
 
-	if len(c.chart.URLs) == 0 {
-		return nil, errors.New("chart has no downloadable URLs")
+	absoluteChartURL, err := c.absoluteURL()
+	if err != nil {
+		return err
+	}
+
+	dest, err := os.MkdirTemp("", "helm-chart")
+	if err != nil {
+		return fmt.Errorf("unable to create temporary directory for download: %w", err)
 	}
+	defer os.RemoveAll(dest)
+
+	_, err = c.downloadArchive(absoluteChartURL, dest, optns)
+	return err
+}
 
-	chartURL = c.chart.URLs[0]
+func (c *Chart) absoluteURL() (string, error) {
+	if len(c.chart.URLs) == 0 {
+		return "", errors.New("chart has no downloadable URLs")
+	}
 
-	absoluteChartURL, err := c.repository.ResolveReferenceURL(chartURL)
+	absoluteChartURL, err := c.repository.ResolveReferenceURL(c.chart.URLs[0])
 	if err != nil {
-		return nil, fmt.Errorf("failed to make chart URL absolute: %w", err)
+		return "", fmt.Errorf("failed to make chart URL absolute: %w", err)
 	}
+	return absoluteChartURL, nil
+}
 
-	isTempPath := false
-	if optns.downloadPath == "" {
-		optns.downloadPath, err = os.MkdirTemp("", "helm-chart")
+type chartArchive struct {
+	filename string
+	// digest is the archive digest, in the "sha256:<hex>" format.
+	digest string
+	// isTempFile is whether the file is temporary, and should be removed after use.
+	isTempFile bool
+	// signedBy is the signer identity of the verified provenance file.
+	signedBy string
+}
+
+// cachedArchive returns the cached chart archive.
+func (c *Chart) cachedArchive(chartURL string) (chartArchive, bool) {
+	cache := c.repository.cache
+	if cache == nil {
+		return chartArchive{}, false
+	}
+	digest := indexDigest(c.chart.Digest)
+	if digest == "" {
+		digest, _ = cache.ChartRef(chartURL + "@" + c.chart.Version)
+	}
+	if digest == "" {
+		return chartArchive{}, false
+	}
+	chartFilename, ok := cache.Chart(digest)
+	return chartArchive{filename: chartFilename, digest: digest}, ok
+}
+
+// downloadArchive downloads the chart archive to the dest folder, or returns it from the cache. The archive digest
+// is checked against the repository index digest, or the OCI manifest chart layer digest. If verification is
+// requested, the provenance file is downloaded and verified, and is also cached.
+func (c *Chart) downloadArchive(chartURL string, dest string, optns chartDownloadOptions) (chartArchive, error) {
+	if archive, ok := c.cachedArchive(chartURL); ok {
+		digest, err := fileDigest(archive.filename)
 		if err != nil {
-			return nil, fmt.Errorf("unable to create temporary directory for download: %w", err)
+			return chartArchive{}, fmt.Errorf("error calculating chart digest: %w", err)
 		}
-		isTempPath = true
+		if err := c.checkDigest(archive.digest, digest); err != nil {
+			return chartArchive{}, fmt.Errorf("invalid cached chart archive: %w", err)
+		}
+		if !optns.verify {
+			return archive, nil
+		}
+		if _, err := os.Stat(archive.filename + ".prov"); err == nil {
+			archive.signedBy, err = verifyArchive(archive.filename, optns.keyring)
+			if err != nil {
+				return chartArchive{}, err
+			}
+			return archive, nil
+		}
+		// the provenance file was not cached, download again.
+	}
+
+	if c.repository.offline {
+		return chartArchive{}, fmt.Errorf("chart %s version %s %w", c.chart.Name, c.chart.Version, ErrNotCached)
+	}
+
+	cache := c.repository.cache
+	ref := chartURL + "@" + c.chart.Version
+
+	var (
+		archive        chartArchive
+		expectedDigest string
+		err            error
+	)
+	if c.repository.index == nil {
+		archive, expectedDigest, err = c.pullArchive(chartURL, dest, optns)
 	} else {
-		err = os.MkdirAll(optns.downloadPath, 0755)
+		archive, err = c.fetchArchive(chartURL, dest, optns)
+		expectedDigest = indexDigest(c.chart.Digest)
+	}
+	if err != nil {
+		return chartArchive{}, err
+	}
+
+	archive.digest, err = fileDigest(archive.filename)
+	if err != nil {
+		return chartArchive{}, fmt.Errorf("error calculating chart digest: %w", err)
+	}
+	if err := c.checkDigest(expectedDigest, archive.digest); err != nil {
+		_ = os.Remove(archive.filename)
+		_ = os.Remove(archive.filename + ".prov")
+		return chartArchive{}, err
+	}
+
+	if optns.verify && c.repository.index == nil {
+		// OCI archives are verified only after the digest check, as they are not verified while pulled.
+		archive.signedBy, err = verifyArchive(archive.filename, optns.keyring)
 		if err != nil {
-			return nil, fmt.Errorf("unable to create output directory for download: %w", err)
+			return chartArchive{}, err
+		}
+	}
+
+	if cache != nil {
+		if err := cache.StoreChart(archive.filename, archive.digest); err != nil {
+			return chartArchive{}, err
+		}
+		if optns.verify {
+			if err := cache.StoreProvenance(archive.filename+".prov", archive.digest); err != nil {
+				return chartArchive{}, err
+			}
+		}
+		if err := cache.StoreChartRef(ref, archive.digest); err != nil {
+			return chartArchive{}, err
 		}
 	}
 
+	return archive, nil
+}
+
+// fetchArchive downloads the chart archive from a chart repository to the dest folder, verifying it with its
+// provenance file if requested.
+func (c *Chart) fetchArchive(chartURL string, dest string, optns chartDownloadOptions) (chartArchive, error) {
 	dl := downloader.ChartDownloader{
 		Out:            os.Stderr,
-		Getters:        allGetters,
+		Getters:        c.repository.getters,
+		Options:        c.repository.auth.downloadOptions(c.repository.URL(), chartURL),
 		RegistryClient: c.repository.registry,
 	}
+	if optns.verify {
+		dl.Verify = downloader.VerifyAlways
+		dl.Keyring = optns.keyring
+	}
 
-	chartPackageFile, _, err := dl.DownloadTo(absoluteChartURL, c.chart.Version, optns.downloadPath)
+	chartPackageFile, verification, err := dl.DownloadTo(chartURL, c.chart.Version, dest)
 	if err != nil {
-		return nil, fmt.Errorf("error downloading chart: %w", err)
+		if optns.verify {
+			return chartArchive{}, fmt.Errorf("error verifying chart %s version %s: %w", c.chart.Name,
+				c.chart.Version, err)
+		}
+		return chartArchive{}, fmt.Errorf("error downloading chart: %w", err)
 	}
 
-	err = chartutil.ExpandFile(optns.downloadPath, chartPackageFile)
+	archive := chartArchive{
+		filename:   chartPackageFile,
+		isTempFile: true,
+	}
+	if optns.verify {
+		archive.signedBy = signerIdentity(verification)
+	}
+	return archive, nil
+}
+
+// pullArchive pulls the chart archive from an OCI registry to the dest folder, with its provenance file if
+// verification is requested. Returns the chart layer digest from the manifest.
+func (c *Chart) pullArchive(chartURL string, dest string, optns chartDownloadOptions) (chartArchive, string, error) {
+	ref := ociReference(c.repository.URL(), c.chart.Name, c.chart.Version)
+
+	result, err := c.repository.registry.Pull(ref, registry.PullOptWithProv(optns.verify))
 	if err != nil {
-		return nil, fmt.Errorf("error expanding chart: %w", err)
+		if optns.verify {
+			return chartArchive{}, "", fmt.Errorf("error verifying chart %s version %s: %w", c.chart.Name,
+				c.chart.Version, err)
+		}
+		return chartArchive{}, "", fmt.Errorf("error downloading chart: %w", err)
+	}
+
+	archive := chartArchive{
+		filename:   filepath.Join(dest, fmt.Sprintf("%s-%s.tgz", c.chart.Name, c.chart.Version)),
+		isTempFile: true,
+	}
+	err = os.WriteFile(archive.filename, result.Chart.Data, 0644)
+	if err != nil {
+		return chartArchive{}, "", fmt.Errorf("error writing chart archive: %w", err)
+	}
+	if optns.verify {
+		err = os.WriteFile(archive.filename+".prov", result.Prov.Data, 0644)
+		if err != nil {
+			return chartArchive{}, "", fmt.Errorf("error writing chart provenance file: %w", err)
+		}
+	}
+	return archive, result.Chart.Digest, nil
+}
+
+// checkDigest returns ErrDigestMismatch if the archive digest is not the expected one. A blank expected digest,
+// which is optional in repository indexes, is not checked.
+func (c *Chart) checkDigest(expected, digest string) error {
+	if expected == "" || strings.EqualFold(expected, digest) {
+		return nil
+	}
+	return fmt.Errorf("%w: chart %s version %s from repository %s has digest %s, but %s was expected",
+		ErrDigestMismatch, c.chart.Name, c.chart.Version, c.repository.URL(), digest, expected)
+}
+
+// localArchive returns the local chart archive file, verifying it with the provenance file next to it if requested.
+func (c *Chart) localArchive(optns chartDownloadOptions) (chartArchive, error) {
+	archive := chartArchive{
+		filename: c.repository.local.path,
+		digest:   c.repository.local.chart.Digest,
+	}
+	if optns.verify {
+		var err error
+		archive.signedBy, err = verifyArchive(archive.filename, optns.keyring)
+		if err != nil {
+			return chartArchive{}, err
+		}
+	}
+	return archive, nil
+}
+
+// verifyArchive verifies the chart archive with the provenance file next to it, returning the signer identity.
+func verifyArchive(filename string, keyring string) (string, error) {
+	verification, err := downloader.VerifyChart(filename, keyring)
+	if err != nil {
+		return "", fmt.Errorf("error verifying chart: %w", err)
 	}
+	return signerIdentity(verification), nil
+}
 
-	_ = os.Remove(chartPackageFile)
-	// if err != nil {
-	// 	return nil, fmt.Errorf("error removing chart temporary file: %w", err)
-	// }
+// signerIdentity returns the identities of the provenance signer, like "Name <email>".
+func signerIdentity(verification *provenance.Verification) string {
+	if verification == nil || verification.SignedBy == nil {
+		return ""
+	}
+	return strings.Join(slices.Sorted(maps.Keys(verification.SignedBy.Identities)), ", ")
+}
 
-	return newChartFiles(c, optns.downloadPath, isTempPath)
+// indexDigest returns the repository index digest in the "sha256:<hex>" format.
+func indexDigest(digest string) string {
+	if digest == "" || strings.Contains(digest, ":") {
+		return digest
+	}
+	return "sha256:" + digest
+}
+
+func fileDigest(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return file.HashReader(f)
 }
 
 func WithChartDownloadPath(path string) ChartDownloadOption {
@@ -91,6 +397,28 @@ func WithChartDownloadPath(path string) ChartDownloadOption {
 
 type ChartDownloadOption func(*chartDownloadOptions)
 
+// WithChartDownloadContext sets the context of the commands run to download the chart, like git.
+func WithChartDownloadContext(ctx context.Context) ChartDownloadOption {
+	return func(options *chartDownloadOptions) {
+		options.ctx = ctx
+	}
+}
+
+// WithChartVerify verifies the chart archive with its provenance file, using the public keys in the keyring file.
+// The default keyring is used if blank.
+func WithChartVerify(keyring string) ChartDownloadOption {
+	return func(options *chartDownloadOptions) {
+		options.verify = true
+		options.keyring = keyring
+		if options.keyring == "" {
+			options.keyring = DefaultKeyring()
+		}
+	}
+}
+
 type chartDownloadOptions struct {
+	ctx          context.Context
 	downloadPath string
+	verify       bool
+	keyring      string
 }
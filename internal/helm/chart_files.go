@@ -12,9 +12,11 @@ type ChartFiles struct {
 	path       string
 	isTempPath bool
 	chartRoot  *os.Root
+	digest     string
+	signedBy   string
 }
 
-func newChartFiles(chart *Chart, path string, isTempPath bool) (*ChartFiles, error) {
+func newChartFiles(chart *Chart, path string, isTempPath bool, digest string, signedBy string) (*ChartFiles, error) {
 	chartRoot, err := os.OpenRoot(filepath.Join(path, filepath.Clean(chart.chart.Name)))
 	if err != nil {
 		return nil, err
@@ -24,6 +26,8 @@ func newChartFiles(chart *Chart, path string, isTempPath bool) (*ChartFiles, err
 		path:       path,
 		isTempPath: isTempPath,
 		chartRoot:  chartRoot,
+		digest:     digest,
+		signedBy:   signedBy,
 	}, nil
 }
 
@@ -31,6 +35,21 @@ func (c *ChartFiles) Root() *os.Root {
 	return c.chartRoot
 }
 
+func (c *ChartFiles) Chart() *Chart {
+	return c.chart
+}
+
+// Digest returns the digest of the downloaded chart archive, in the "sha256:<hex>" format, or the checked out commit
+// in the "git:<commit>" format for git repositories.
+func (c *ChartFiles) Digest() string {
+	return c.digest
+}
+
+// SignedBy returns the signer identity of the chart provenance file, if it was verified.
+func (c *ChartFiles) SignedBy() string {
+	return c.signedBy
+}
+
 func (c *ChartFiles) Iter() file.Iter {
 	return file.IterDir(c.chartRoot.FS(), ".")
 }
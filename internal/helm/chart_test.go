@@ -0,0 +1,65 @@
+package helm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func TestDownloadRemovesTempPath(t *testing.T) {
+	archivePath, err := chartutil.Save(&chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: "v2", Name: "demo", Version: "1.0.0"},
+	}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := "apiVersion: v1\nentries:\n  demo:\n    - apiVersion: v2\n      name: demo\n      version: 1.0.0\n" +
+		fmt.Sprintf("      digest: %s\n", strings.Repeat("0", 64)) +
+		"      urls:\n        - demo-1.0.0.tgz\n"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.yaml":
+			_, _ = w.Write([]byte(index))
+		case "/demo-1.0.0.tgz":
+			http.ServeFile(w, r, archivePath)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	repository, err := LoadRepository(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	demoChart, err := repository.GetChart("demo", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempPath := t.TempDir()
+	t.Setenv("TMPDIR", tempPath)
+
+	_, err = demoChart.Download()
+	if !errors.Is(err, ErrDigestMismatch) {
+		t.Fatalf("Download() error = %v, want %v", err, ErrDigestMismatch)
+	}
+
+	leftover, err := filepath.Glob(filepath.Join(tempPath, "helm-chart*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftover) > 0 {
+		t.Errorf("temporary download folders left behind: %v", leftover)
+	}
+}
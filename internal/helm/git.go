@@ -0,0 +1,291 @@
+package helm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/rrgmc/helm-vendor/internal/file"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// GitSource is a Git repository containing a chart, with versions listed from its tags.
+type GitSource struct {
+	// URL is the repository URL as configured, which is returned by URL().
+	URL string
+	// FetchURL is the URL used by git, if different from URL, like a relative path resolved from another folder.
+	FetchURL string
+	// Ref is a fixed branch, tag or commit to use instead of listing versions from the tags. It is used as the
+	// chart version, and is resolved to its current commit when the repository is loaded.
+	Ref string
+	// TagPattern selects the tags which are chart versions, with "*" as the version placeholder, like "v*" or
+	// "my-chart-*". The default is "*".
+	TagPattern string
+	// Path is the chart folder inside the repository. The default is the repository root.
+	Path string
+}
+
+// gitRepository is the chart versions and their refs read from a Git repository.
+type gitRepository struct {
+	source   GitSource
+	versions []gitVersion
+}
+
+type gitVersion struct {
+	version string
+	ref     string
+	// commit is the commit of the ref, if known.
+	commit string
+}
+
+// LoadGitRepository loads the chart versions from a Git repository, using the git command line. Credentials are
+// handled by git.
+func LoadGitRepository(ctx context.Context, source GitSource, options ...RepositoryOption) (*Repository, error) {
+	var optns repositoryOptions
+	for _, opt := range options {
+		opt(&optns)
+	}
+
+	if optns.offline {
+		return nil, fmt.Errorf("git repository %s cannot be used in offline mode", source.URL)
+	}
+
+	gitRepo := &gitRepository{
+		source: source,
+	}
+
+	if source.Ref != "" {
+		// a branch moves, so the commit is checked out instead of the ref.
+		commit, err := resolveGitRef(ctx, source)
+		if err != nil {
+			return nil, fmt.Errorf("error loading git repository %s: %w", source.URL, err)
+		}
+		gitRepo.versions = []gitVersion{{version: source.Ref, ref: commit, commit: commit}}
+	} else {
+		var err error
+		gitRepo.versions, err = listGitVersions(ctx, source)
+		if err != nil {
+			return nil, fmt.Errorf("error loading git repository %s: %w", source.URL, err)
+		}
+	}
+
+	return &Repository{
+		repository: &repo.ChartRepository{
+			Config: &repo.Entry{
+				URL: source.URL,
+			},
+		},
+		git:     gitRepo,
+		auth:    optns.auth,
+		getters: allGetters,
+		cache:   optns.cache,
+		offline: optns.offline,
+	}, nil
+}
+
+// listGitVersions lists the repository tags matching the tag pattern, whose version is a semantic version, from
+// the highest version to the lowest.
+func listGitVersions(ctx context.Context, source GitSource) ([]gitVersion, error) {
+	tagPattern := source.TagPattern
+	if tagPattern == "" {
+		tagPattern = "*"
+	}
+	prefix, suffix, ok := strings.Cut(tagPattern, "*")
+	if !ok || strings.Contains(suffix, "*") {
+		return nil, fmt.Errorf("tag pattern '%s' must contain a single '*' version placeholder", tagPattern)
+	}
+
+	out, err := runGit(ctx, "", "ls-remote", "--tags", "--refs", source.fetchURL())
+	if err != nil {
+		return nil, err
+	}
+
+	type tagVersion struct {
+		version *semver.Version
+		ref     string
+	}
+
+	var tags []tagVersion
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		_, ref, ok := strings.Cut(scanner.Text(), "\t")
+		if !ok {
+			continue
+		}
+		tag, ok := strings.CutPrefix(ref, "refs/tags/")
+		if !ok || !strings.HasPrefix(tag, prefix) || !strings.HasSuffix(tag, suffix) ||
+			len(tag) < len(prefix)+len(suffix) {
+			continue
+		}
+		version, err := semver.StrictNewVersion(tag[len(prefix) : len(tag)-len(suffix)])
+		if err != nil {
+			continue
+		}
+		tags = append(tags, tagVersion{version: version, ref: ref})
+	}
+
+	slices.SortStableFunc(tags, func(a, b tagVersion) int {
+		return b.version.Compare(a.version)
+	})
+
+	var ret []gitVersion
+	for _, tag := range tags {
+		ret = append(ret, gitVersion{version: tag.version.Original(), ref: tag.ref})
+	}
+	return ret, nil
+}
+
+// resolveGitRef returns the commit of the source ref, which may be a branch, a tag or a full commit hash. Names
+// are resolved in the same order as git does, and tags are peeled to their commit.
+func resolveGitRef(ctx context.Context, source GitSource) (string, error) {
+	out, err := runGit(ctx, "", "ls-remote", source.fetchURL(), source.Ref)
+	if err != nil {
+		return "", err
+	}
+
+	refs := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		commit, ref, ok := strings.Cut(scanner.Text(), "\t")
+		if ok {
+			refs[ref] = commit
+		}
+	}
+
+	for _, ref := range []string{source.Ref, "refs/tags/" + source.Ref, "refs/heads/" + source.Ref} {
+		for _, name := range []string{ref + "^{}", ref} {
+			if commit, ok := refs[name]; ok {
+				return commit, nil
+			}
+		}
+	}
+
+	if isGitCommit(source.Ref) {
+		return source.Ref, nil
+	}
+	return "", fmt.Errorf("ref '%s' not found", source.Ref)
+}
+
+// isGitCommit returns whether ref is a full SHA-1 or SHA-256 commit hash.
+func isGitCommit(ref string) bool {
+	if len(ref) != 40 && len(ref) != 64 {
+		return false
+	}
+	return strings.Trim(ref, "0123456789abcdef") == ""
+}
+
+func (r *Repository) chartVersionsGit(name string, maxAmount int) iter.Seq2[*repo.ChartVersion, error] {
+	return func(yield func(*repo.ChartVersion, error) bool) {
+		var ct int
+		for _, version := range r.git.versions {
+			cv := &repo.ChartVersion{
+				Metadata: &chart.Metadata{
+					Name:    name,
+					Version: version.version,
+				},
+				URLs: []string{version.ref},
+			}
+			if version.commit != "" {
+				cv.Digest = "git:" + version.commit
+			}
+			if !yield(cv, nil) {
+				return
+			}
+			ct++
+			if maxAmount > 0 && ct >= maxAmount {
+				return
+			}
+		}
+	}
+}
+
+// downloadGit checks out the chart version ref and copies the chart folder to the dest folder, in a subfolder with
+// the chart name as done when expanding a chart archive. Returns the commit digest, in the "git:<commit>" format.
+func (c *Chart) downloadGit(ctx context.Context, dest string) (string, error) {
+	if len(c.chart.URLs) == 0 {
+		return "", errors.New("chart has no git ref")
+	}
+	source := c.repository.git.source
+
+	checkoutPath, err := os.MkdirTemp("", "helm-chart-git")
+	if err != nil {
+		return "", fmt.Errorf("unable to create temporary directory for checkout: %w", err)
+	}
+	defer os.RemoveAll(checkoutPath)
+
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"fetch", "--quiet", "--depth", "1", source.fetchURL(), c.chart.URLs[0]},
+		{"checkout", "--quiet", "FETCH_HEAD"},
+	} {
+		if _, err := runGit(ctx, checkoutPath, args...); err != nil {
+			return "", fmt.Errorf("error checking out %s: %w", c.chart.URLs[0], err)
+		}
+	}
+
+	commit, err := runGit(ctx, checkoutPath, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	err = os.RemoveAll(filepath.Join(checkoutPath, ".git"))
+	if err != nil {
+		return "", err
+	}
+
+	srcRoot, err := os.OpenRoot(filepath.Join(checkoutPath, filepath.Clean(source.Path)))
+	if err != nil {
+		return "", fmt.Errorf("error opening chart path '%s': %w", source.Path, err)
+	}
+	defer srcRoot.Close()
+
+	chartPath := filepath.Join(dest, filepath.Clean(c.chart.Name))
+	err = os.MkdirAll(chartPath, os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+	dstRoot, err := os.OpenRoot(chartPath)
+	if err != nil {
+		return "", err
+	}
+	defer dstRoot.Close()
+
+	err = file.CopyTree(srcRoot, dstRoot)
+	if err != nil {
+		return "", fmt.Errorf("error copying chart files: %w", err)
+	}
+
+	return "git:" + strings.TrimSpace(string(commit)), nil
+}
+
+// fetchURL returns the URL used by git.
+func (s GitSource) fetchURL() string {
+	if s.FetchURL != "" {
+		return s.FetchURL
+	}
+	return s.URL
+}
+
+func runGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// never ask for credentials interactively
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
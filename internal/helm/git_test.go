@@ -0,0 +1,216 @@
+package helm
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newGitTestRepository creates a bare git repository with a chart in the "chart" folder, tagged with each tag.
+func newGitTestRepository(t *testing.T, tags ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	ctx := context.Background()
+	workPath := t.TempDir()
+	barePath := filepath.Join(t.TempDir(), "repo.git")
+
+	git := func(dir string, args ...string) {
+		t.Helper()
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com",
+			"-c", "commit.gpgsign=false", "-c", "tag.gpgsign=false"}, args...)
+		if _, err := runGit(ctx, dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git(workPath, "init", "--quiet")
+	err := os.MkdirAll(filepath.Join(workPath, "chart"), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range tags {
+		err = os.WriteFile(filepath.Join(workPath, "chart", "Chart.yaml"),
+			[]byte("apiVersion: v2\nname: demo\nversion: "+tag+"\n"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		git(workPath, "add", "-A")
+		git(workPath, "commit", "--quiet", "-m", tag)
+		git(workPath, "tag", tag)
+	}
+	git("", "clone", "--quiet", "--bare", workPath, barePath)
+
+	return barePath
+}
+
+func TestGitRepository(t *testing.T) {
+	barePath := newGitTestRepository(t, "v1.0.0", "v1.1.0", "other", "v2.0.0-rc.1", "v1.10.0")
+	ctx := context.Background()
+
+	for name, repoURL := range map[string]string{"path": barePath, "file URL": "file://" + barePath} {
+		t.Run(name, func(t *testing.T) {
+			repository, err := LoadGitRepository(ctx, GitSource{
+				URL:        repoURL,
+				TagPattern: "v*",
+				Path:       "chart",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var versions []string
+			for version, err := range repository.ChartVersions("demo", -1) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				versions = append(versions, version.Version)
+			}
+			if want := []string{"2.0.0-rc.1", "1.10.0", "1.1.0", "1.0.0"}; !slices.Equal(versions, want) {
+				t.Errorf("versions = %v, want %v", versions, want)
+			}
+
+			chart, err := repository.GetChart("demo", "1.1.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			chartFiles, err := chart.Download(WithChartDownloadContext(ctx))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer chartFiles.Close()
+
+			data, err := chartFiles.Root().ReadFile("Chart.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), "version: v1.1.0\n") {
+				t.Errorf("downloaded Chart.yaml is not from tag v1.1.0:\n%s", data)
+			}
+			if !strings.HasPrefix(chartFiles.Digest(), "git:") {
+				t.Errorf("digest = %q, want a git commit digest", chartFiles.Digest())
+			}
+		})
+	}
+}
+
+func TestGitRepositoryFetchURL(t *testing.T) {
+	barePath := newGitTestRepository(t, "1.0.0")
+
+	repository, err := LoadGitRepository(context.Background(), GitSource{
+		URL:      "repo.git",
+		FetchURL: barePath,
+		Path:     "chart",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repository.URL() != "repo.git" {
+		t.Errorf("URL() = %q, want the configured URL", repository.URL())
+	}
+
+	chart, err := repository.GetChart("demo", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chartFiles, err := chart.Download()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = chartFiles.Close()
+}
+
+func TestGitRepositoryBranchRef(t *testing.T) {
+	barePath := newGitTestRepository(t, "1.0.0")
+	ctx := context.Background()
+
+	out, err := runGit(ctx, barePath, "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch := strings.TrimSpace(string(out))
+
+	loadChart := func() *Chart {
+		t.Helper()
+		repository, err := LoadGitRepository(ctx, GitSource{
+			URL:  barePath,
+			Ref:  branch,
+			Path: "chart",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		chart, err := repository.GetChart("demo", branch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chart
+	}
+
+	download := func(chart *Chart) (string, string) {
+		t.Helper()
+		chartFiles, err := chart.Download(WithChartDownloadContext(ctx))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer chartFiles.Close()
+		data, err := chartFiles.Root().ReadFile("Chart.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data), chartFiles.Digest()
+	}
+
+	chart := loadChart()
+	_, lockedDigest := download(chart)
+	if chart.Chart().Digest != lockedDigest {
+		t.Errorf("chart digest = %q, want the checked out commit %q", chart.Chart().Digest, lockedDigest)
+	}
+
+	// move the branch to a new commit
+	workPath := filepath.Join(t.TempDir(), "work")
+	if _, err := runGit(ctx, "", "clone", "--quiet", barePath, workPath); err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(workPath, "chart", "Chart.yaml"),
+		[]byte("apiVersion: v2\nname: demo\nversion: 2.0.0\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"commit", "--quiet", "-a", "-m", "2.0.0"},
+		{"push", "--quiet", "origin", branch},
+	} {
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com",
+			"-c", "commit.gpgsign=false"}, args...)
+		if _, err := runGit(ctx, workPath, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chart = loadChart()
+	if chart.Chart().Version != branch {
+		t.Errorf("version = %q, want the ref %q", chart.Chart().Version, branch)
+	}
+	if chart.Chart().Digest == lockedDigest {
+		t.Errorf("chart digest is still the locked commit %q after the branch moved", lockedDigest)
+	}
+
+	lockedChart, err := chart.repository.GetLockedChart("demo", branch, lockedDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, digest := download(lockedChart)
+	if digest != lockedDigest {
+		t.Errorf("locked chart digest = %q, want %q", digest, lockedDigest)
+	}
+	if !strings.Contains(data, "version: 1.0.0\n") {
+		t.Errorf("locked Chart.yaml is not from the locked commit:\n%s", data)
+	}
+}
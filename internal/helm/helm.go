@@ -1,9 +1,12 @@
 package helm
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/rrgmc/helm-vendor/internal/yaml"
 	"helm.sh/helm/v3/pkg/cli"
 	"helm.sh/helm/v3/pkg/getter"
@@ -43,4 +46,48 @@ func GetChartVersion(chartVersion *repo.ChartVersion) string {
 	return ver
 }
 
-var allGetters = getter.All(&cli.EnvSettings{})
+// DefaultKeyring returns the default keyring file used to verify charts, the same as the Helm command line.
+func DefaultKeyring() string {
+	if gnupgHome := os.Getenv("GNUPGHOME"); gnupgHome != "" {
+		return filepath.Join(gnupgHome, "pubring.gpg")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".gnupg", "pubring.gpg")
+}
+
+// IsPrerelease returns whether the version is a semantic version with a pre-release, like "1.0.0-rc.1".
+func IsPrerelease(version string) bool {
+	sv, err := semver.NewVersion(version)
+	return err == nil && sv.Prerelease() != ""
+}
+
+// IsVersionConstraint returns whether the version is a semantic version constraint like "~1.4" or ">=2.0 <3", and not
+// a single version.
+func IsVersionConstraint(version string) bool {
+	if version == "" {
+		return false
+	}
+	if _, err := semver.StrictNewVersion(version); err == nil {
+		return false
+	}
+	_, err := semver.NewConstraint(version)
+	return err == nil
+}
+
+// FindRepositoryEntry finds a repository added with "helm repo add" by name in Helm's repositories file.
+func FindRepositoryEntry(name string) (*repo.Entry, error) {
+	repoFile, err := repo.LoadFile(settings.RepositoryConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error loading helm repositories file %s: %w", settings.RepositoryConfig, err)
+	}
+	entry := repoFile.Get(name)
+	if entry == nil {
+		return nil, fmt.Errorf("repository '%s' not found in helm repositories file %s", name, settings.RepositoryConfig)
+	}
+	return entry, nil
+}
+
+// settings are Helm's environment settings, used to locate the repositories and registry configuration files.
+var settings = cli.New()
+
+var allGetters = getter.All(settings)
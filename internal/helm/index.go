@@ -0,0 +1,74 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/rrgmc/helm-vendor/internal/cache"
+)
+
+// fetchIndexFile downloads the repository index file into the cache, revalidating a previously cached file using
+// the ETag and Last-Modified headers. Returns the cached index file name.
+func fetchIndexFile(ctx context.Context, repoURL string, auth RepositoryAuth, c *cache.Cache) (string, error) {
+	indexURL, err := url.Parse(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid repository URL: %w", err)
+	}
+	indexURL.RawPath = path.Join(indexURL.RawPath, "index.yaml")
+	indexURL.Path = path.Join(indexURL.Path, "index.yaml")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, indexURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "helm-vendor")
+
+	switch {
+	case auth.Token != "":
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+	case auth.Username != "" && auth.Password != "":
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+
+	cachedFilename, meta, isCached := c.Index(repoURL)
+	if isCached {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	transport, err := auth.transport()
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && isCached:
+		return cachedFilename, nil
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("failed to fetch %s : %s", indexURL.String(), resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading index file: %w", err)
+	}
+
+	return c.StoreIndex(repoURL, data, cache.IndexMeta{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	})
+}
@@ -0,0 +1,115 @@
+package helm
+
+import (
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rrgmc/helm-vendor/internal/file"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// localRepository is a chart in a local folder or archive file, which has a single version.
+type localRepository struct {
+	path      string
+	isArchive bool
+	chart     *repo.ChartVersion
+}
+
+// IsLocalURL returns whether the repository URL is a "file://" URL of a local chart folder or archive file.
+func IsLocalURL(repoURL string) bool {
+	return strings.HasPrefix(repoURL, "file://")
+}
+
+// LocalURLPath returns the path of a "file://" URL.
+func LocalURLPath(repoURL string) string {
+	return strings.TrimPrefix(repoURL, "file://")
+}
+
+// LoadLocalRepository loads a chart from a local folder or ".tgz" archive file in path. repoURL is the "file://"
+// URL as configured, which is returned by URL().
+func LoadLocalRepository(repoURL string, path string, options ...RepositoryOption) (*Repository, error) {
+	var optns repositoryOptions
+	for _, opt := range options {
+		opt(&optns)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading local chart %s: %w", repoURL, err)
+	}
+
+	loadedChart, err := loader.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading local chart %s: %w", repoURL, err)
+	}
+
+	localRepo := &localRepository{
+		path:      path,
+		isArchive: !info.IsDir(),
+		chart: &repo.ChartVersion{
+			Metadata: loadedChart.Metadata,
+			URLs:     []string{repoURL},
+		},
+	}
+
+	if localRepo.isArchive {
+		localRepo.chart.Digest, err = fileDigest(path)
+		if err != nil {
+			return nil, fmt.Errorf("error calculating chart digest: %w", err)
+		}
+	}
+
+	return &Repository{
+		repository: &repo.ChartRepository{
+			Config: &repo.Entry{
+				URL: repoURL,
+			},
+		},
+		local:   localRepo,
+		auth:    optns.auth,
+		getters: allGetters,
+		cache:   optns.cache,
+		offline: optns.offline,
+	}, nil
+}
+
+func (r *Repository) chartVersionsLocal(name string) iter.Seq2[*repo.ChartVersion, error] {
+	return func(yield func(*repo.ChartVersion, error) bool) {
+		if name != r.local.chart.Name {
+			yield(nil, fmt.Errorf("unknown chart %s, the local chart is %s", name, r.local.chart.Name))
+			return
+		}
+		yield(r.local.chart, nil)
+	}
+}
+
+// downloadLocal copies the local chart folder to the dest folder, in a subfolder with the chart name. Archive files
+// are expanded by Download as the downloaded ones. Returns a blank digest.
+func (c *Chart) downloadLocal(dest string) (string, error) {
+	srcRoot, err := os.OpenRoot(c.repository.local.path)
+	if err != nil {
+		return "", err
+	}
+	defer srcRoot.Close()
+
+	chartPath := filepath.Join(dest, filepath.Clean(c.chart.Name))
+	err = os.MkdirAll(chartPath, os.ModePerm)
+	if err != nil {
+		return "", err
+	}
+	dstRoot, err := os.OpenRoot(chartPath)
+	if err != nil {
+		return "", err
+	}
+	defer dstRoot.Close()
+
+	err = file.CopyTree(srcRoot, dstRoot)
+	if err != nil {
+		return "", fmt.Errorf("error copying chart files: %w", err)
+	}
+	return "", nil
+}
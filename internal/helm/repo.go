@@ -1,13 +1,18 @@
 package helm
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"iter"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/Masterminds/semver/v3"
+	"github.com/rrgmc/helm-vendor/internal/cache"
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/helmpath"
 	"helm.sh/helm/v3/pkg/registry"
 	"helm.sh/helm/v3/pkg/repo"
@@ -17,9 +22,23 @@ type Repository struct {
 	repository *repo.ChartRepository
 	index      *repo.IndexFile
 	registry   *registry.Client
+	git        *gitRepository
+	local      *localRepository
+	auth       RepositoryAuth
+	getters    getter.Providers
+	cache      *cache.Cache
+	offline    bool
 }
 
-func LoadRepository(repoURL string) (*Repository, error) {
+// ErrNotCached is returned in offline mode when an index file or chart archive was not previously cached.
+var ErrNotCached = errors.New("not found in the cache (use the 'prefetch' command while online to cache it)")
+
+func LoadRepository(ctx context.Context, repoURL string, options ...RepositoryOption) (*Repository, error) {
+	var optns repositoryOptions
+	for _, opt := range options {
+		opt(&optns)
+	}
+
 	c := repo.Entry{
 		URL:                   repoURL,
 		Username:              "",
@@ -31,18 +50,41 @@ func LoadRepository(repoURL string) (*Repository, error) {
 		Name:                  randomName(),
 		InsecureSkipTLSverify: false,
 	}
+	optns.auth.applyEntry(&c)
+
+	if optns.offline && optns.cache == nil {
+		return nil, errors.New("offline mode requires the cache")
+	}
+
 	if registry.IsOCI(repoURL) {
-		return loadRepositoryOCI(&c)
+		return loadRepositoryOCI(&c, optns)
+	}
+
+	getters, err := optns.auth.getters(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("error loading repository %s: %w", repoURL, err)
 	}
-	repository, err := repo.NewChartRepository(&c, allGetters)
+
+	repository, err := repo.NewChartRepository(&c, getters)
 	if err != nil {
 		return nil, fmt.Errorf("error loading repository %s: %w", repoURL, err)
 	}
-	return loadRepository(repository)
+	return loadRepository(ctx, repository, optns, getters)
 }
 
-func loadRepository(repository *repo.ChartRepository) (*Repository, error) {
-	indexFilename, err := repository.DownloadIndexFile()
+func loadRepository(ctx context.Context, repository *repo.ChartRepository, optns repositoryOptions, getters getter.Providers) (*Repository, error) {
+	var indexFilename string
+	var err error
+	if optns.offline {
+		var ok bool
+		if indexFilename, _, ok = optns.cache.Index(repository.Config.URL); !ok {
+			err = fmt.Errorf("index file of repository %s %w", repository.Config.URL, ErrNotCached)
+		}
+	} else if optns.cache != nil && isHTTPURL(repository.Config.URL) {
+		indexFilename, err = fetchIndexFile(ctx, repository.Config.URL, optns.auth, optns.cache)
+	} else {
+		indexFilename, err = repository.DownloadIndexFile()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error downloading repository index file: %w", err)
 	}
@@ -56,48 +98,71 @@ func loadRepository(repository *repo.ChartRepository) (*Repository, error) {
 	return &Repository{
 		repository: repository,
 		index:      repoIndex,
+		auth:       optns.auth,
+		getters:    getters,
+		cache:      optns.cache,
+		offline:    optns.offline,
 	}, nil
 }
 
-func loadRepositoryOCI(entry *repo.Entry) (*Repository, error) {
-	// ref := strings.TrimPrefix(entry.URL, fmt.Sprintf("%s://", registry.OCIScheme))
+func loadRepositoryOCI(entry *repo.Entry, optns repositoryOptions) (*Repository, error) {
+	registryOptions, err := optns.auth.registryOptions()
+	if err != nil {
+		return nil, fmt.Errorf("error creating registry client: %w", err)
+	}
 
-	registryClient, err := registry.NewClient(
-		// registry.ClientOptDebug(true),
+	// credentials are passed directly to the client, so there is no need to login and store them.
+	registryClient, err := registry.NewClient(append([]registry.ClientOption{
 		registry.ClientOptEnableCache(false),
-		// registry.ClientOptWriter(os.Stdout),
-		// registry.ClientOptCredentialsFile(credentialsFile),
-	)
+	}, registryOptions...)...)
 	if err != nil {
 		return nil, fmt.Errorf("error creating registry client: %w", err)
 	}
 
-	// err = registryClient.Login(
-	// 	ref,
-	// 	// registry.LoginOptBasicAuth(srv.TestUsername, srv.TestPassword),
-	// 	// registry.LoginOptInsecure(true),
-	// 	// registry.LoginOptPlainText(true),
-	// )
-	// if err != nil {
-	// 	return nil, fmt.Errorf("error logging into registry with good credentials: %w", err)
-	// }
-
 	return &Repository{
 		repository: &repo.ChartRepository{
 			Config: entry,
 		},
 		index:    nil,
 		registry: registryClient,
+		auth:     optns.auth,
+		getters:  allGetters,
+		cache:    optns.cache,
+		offline:  optns.offline,
 	}, nil
 }
 
+func (r *Repository) URL() string {
+	return r.repository.Config.URL
+}
+
 func (r *Repository) ResolveReferenceURL(url string) (string, error) {
 	return repo.ResolveReferenceURL(r.repository.Config.URL, url)
 }
 
 func (r *Repository) GetChart(name, version string) (*Chart, error) {
+	if r.git != nil || r.local != nil {
+		findChart, err := r.FindChartVersion(name, version)
+		if err != nil {
+			return nil, err
+		}
+		if findChart == nil {
+			return nil, fmt.Errorf("version '%s' of chart %s not found in repository %s", version, name,
+				r.repository.Config.URL)
+		}
+		return LoadChart(r, findChart)
+	}
+
 	if r.index == nil {
 		findChart, err := r.FindChartVersion(name, version)
+		if IsVersionConstraint(version) {
+			if err != nil {
+				return nil, err
+			}
+			if findChart == nil {
+				return nil, fmt.Errorf("no version of chart %s matches the constraint '%s'", name, version)
+			}
+		}
 		if err != nil || findChart == nil {
 			// errors may be because it is not possible to list tags
 			return LoadChart(r, &repo.ChartVersion{
@@ -119,13 +184,42 @@ func (r *Repository) GetChart(name, version string) (*Chart, error) {
 	return LoadChart(r, c)
 }
 
+// GetLockedChart returns the chart version as it was vendored, with the digest returned by ChartFiles.Digest. Git
+// repositories check out the commit of the digest, as a branch may have moved since. Other repositories return the
+// same as GetChart.
+func (r *Repository) GetLockedChart(name, version, digest string) (*Chart, error) {
+	if commit, ok := strings.CutPrefix(digest, "git:"); ok && r.git != nil {
+		return LoadChart(r, &repo.ChartVersion{
+			Metadata: &chart.Metadata{
+				Name:    name,
+				Version: version,
+			},
+			URLs:   []string{commit},
+			Digest: digest,
+		})
+	}
+	return r.GetChart(name, version)
+}
+
+// FindChartVersion finds the chart version, which can also be a semantic version constraint, in which case the
+// highest matching version is returned. If version is blank, the first one which is not a pre-release is returned.
 func (r *Repository) FindChartVersion(name string, version string) (*repo.ChartVersion, error) {
+	if IsVersionConstraint(version) {
+		constraint, err := semver.NewConstraint(version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint '%s': %w", version, err)
+		}
+		return r.FindChartVersionMatching(name, constraint.Check)
+	}
 	for cv, err := range r.ChartVersions(name, 0) {
 		if err != nil {
 			return nil, err
 		}
 		if version == "" {
-			// return the first one
+			// return the first one which is not a pre-release
+			if IsPrerelease(cv.Version) {
+				continue
+			}
 			return cv, nil
 		}
 		if version == cv.Version {
@@ -135,7 +229,43 @@ func (r *Repository) FindChartVersion(name string, version string) (*repo.ChartV
 	return nil, nil
 }
 
+// FindChartVersionMatching returns the first (latest) chart version whose semantic version is accepted by the match
+// function. Versions which are not valid semantic versions are skipped. Returns nil if no version matches.
+func (r *Repository) FindChartVersionMatching(name string, match func(version *semver.Version) bool) (*repo.ChartVersion, error) {
+	for cv, err := range r.ChartVersions(name, 0) {
+		if err != nil {
+			return nil, err
+		}
+		sv, err := semver.NewVersion(cv.Version)
+		if err != nil {
+			continue
+		}
+		if match(sv) {
+			return cv, nil
+		}
+	}
+	return nil, nil
+}
+
+// GetChartMatching returns the latest chart version whose semantic version is accepted by the match function.
+func (r *Repository) GetChartMatching(name string, match func(version *semver.Version) bool) (*Chart, error) {
+	cv, err := r.FindChartVersionMatching(name, match)
+	if err != nil {
+		return nil, err
+	}
+	if cv == nil {
+		return nil, fmt.Errorf("no version of chart %s matches the requirements", name)
+	}
+	return LoadChart(r, cv)
+}
+
 func (r *Repository) ChartVersions(name string, maxAmount int) iter.Seq2[*repo.ChartVersion, error] {
+	if r.git != nil {
+		return r.chartVersionsGit(name, maxAmount)
+	}
+	if r.local != nil {
+		return r.chartVersionsLocal(name)
+	}
 	if r.index == nil {
 		return r.chartVersionsOCI(name, maxAmount)
 	}
@@ -165,13 +295,13 @@ func (r *Repository) chartVersionsOCI(name string, maxAmount int) iter.Seq2[*rep
 		// }
 
 		ref := strings.TrimPrefix(JoinHTTPPaths(r.repository.Config.URL, name), fmt.Sprintf("%s://", registry.OCIScheme))
-		tags, err := r.registry.Tags(ref)
+		tags, err := r.tagsOCI(ref)
 		if err != nil {
 			yield(nil, fmt.Errorf("error getting tags for chart %s: %w", name, err))
 			return
 		}
 		var ct int
-		for _, entry := range tags {
+		for _, entry := range sortTagVersions(tags) {
 			if !yield(&repo.ChartVersion{
 				Metadata: &chart.Metadata{
 					Name:    name,
@@ -189,6 +319,27 @@ func (r *Repository) chartVersionsOCI(name string, maxAmount int) iter.Seq2[*rep
 	}
 }
 
+// tagsOCI returns the tags of the OCI chart reference, from the cache if offline.
+func (r *Repository) tagsOCI(ref string) ([]string, error) {
+	if r.offline {
+		tags, ok := r.cache.Tags(ref)
+		if !ok {
+			return nil, fmt.Errorf("tags of %s %w", ref, ErrNotCached)
+		}
+		return tags, nil
+	}
+	tags, err := r.registry.Tags(ref)
+	if err != nil {
+		return nil, err
+	}
+	if r.cache != nil {
+		if err := r.cache.StoreTags(ref, tags); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
 func (r *Repository) Close() error {
 	if r.repository.CachePath == "" {
 		return nil
@@ -197,3 +348,31 @@ func (r *Repository) Close() error {
 	_ = os.RemoveAll(filepath.Join(r.repository.CachePath, helmpath.CacheIndexFile(r.repository.Config.Name)))
 	return nil
 }
+
+func WithRepositoryAuth(auth RepositoryAuth) RepositoryOption {
+	return func(options *repositoryOptions) {
+		options.auth = auth
+	}
+}
+
+// WithRepositoryCache stores index files and chart archives in the cache.
+func WithRepositoryCache(cache *cache.Cache) RepositoryOption {
+	return func(options *repositoryOptions) {
+		options.cache = cache
+	}
+}
+
+// WithRepositoryOffline serves index files and chart archives only from the cache, never accessing the network.
+func WithRepositoryOffline() RepositoryOption {
+	return func(options *repositoryOptions) {
+		options.offline = true
+	}
+}
+
+type RepositoryOption func(*repositoryOptions)
+
+type repositoryOptions struct {
+	auth    RepositoryAuth
+	cache   *cache.Cache
+	offline bool
+}
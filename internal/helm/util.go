@@ -9,6 +9,8 @@ import (
 	"maps"
 	"slices"
 	"strings"
+
+	"github.com/Masterminds/semver/v3"
 )
 
 func randomName() string {
@@ -17,6 +19,41 @@ func randomName() string {
 	return strings.ReplaceAll(base64.StdEncoding.EncodeToString(buf), "/", "-")
 }
 
+func isHTTPURL(u string) bool {
+	return strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")
+}
+
+// sortTagVersions parses the OCI tags as semantic versions, returning them sorted from the highest to the lowest.
+// Tags which are not semantic versions are skipped. As "+" is not allowed in OCI tags, "_" is decoded back to "+" as
+// done by Helm.
+func sortTagVersions(tags []string) []string {
+	var versions []*semver.Version
+	for _, tag := range tags {
+		version, err := semver.StrictNewVersion(strings.ReplaceAll(tag, "_", "+"))
+		if err != nil {
+			continue
+		}
+		versions = append(versions, version)
+	}
+
+	slices.SortStableFunc(versions, func(a, b *semver.Version) int {
+		return b.Compare(a)
+	})
+
+	ret := make([]string, 0, len(versions))
+	for _, version := range versions {
+		ret = append(ret, version.String())
+	}
+	return ret
+}
+
+// ociReference returns the OCI reference of the chart version, without the "oci://" scheme. As "+" is not allowed in
+// OCI tags, it is encoded as "_" as done by Helm.
+func ociReference(repoURL, name, version string) string {
+	return fmt.Sprintf("%s:%s", strings.TrimPrefix(JoinHTTPPaths(repoURL, name), "oci://"),
+		strings.ReplaceAll(version, "+", "_"))
+}
+
 func JoinHTTPPaths(baseURL, paths string) string {
 	return fmt.Sprintf("%s/%s", strings.TrimSuffix(strings.TrimSpace(baseURL), "/"), paths)
 }
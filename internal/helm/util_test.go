@@ -0,0 +1,70 @@
+package helm
+
+import (
+	"slices"
+	"testing"
+
+	"oras.land/oras-go/v2/registry"
+)
+
+func TestOCIReference(t *testing.T) {
+	tests := []struct {
+		repoURL string
+		name    string
+		version string
+		want    string
+	}{
+		{"oci://registry.example.com/charts", "demo", "0.45.0", "registry.example.com/charts/demo:0.45.0"},
+		{"oci://registry.example.com/charts/", "demo", "1.0.0", "registry.example.com/charts/demo:1.0.0"},
+		{"oci://registry.example.com/charts", "demo", "1.0.0+build.1", "registry.example.com/charts/demo:1.0.0_build.1"},
+	}
+	for _, tt := range tests {
+		if got := ociReference(tt.repoURL, tt.name, tt.version); got != tt.want {
+			t.Errorf("ociReference(%q, %q, %q) = %q, want %q", tt.repoURL, tt.name, tt.version, got, tt.want)
+		}
+		if _, err := registry.ParseReference(tt.want); err != nil {
+			t.Errorf("invalid reference %q: %s", tt.want, err)
+		}
+	}
+}
+
+func TestSortTagVersions(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		want []string
+	}{
+		{
+			name: "semantic order",
+			tags: []string{"1.2.0", "1.10.0", "1.9.1", "0.1.0"},
+			want: []string{"1.10.0", "1.9.1", "1.2.0", "0.1.0"},
+		},
+		{
+			name: "pre-releases before releases",
+			tags: []string{"1.0.0-rc.1", "1.0.0", "1.0.0-alpha", "0.9.0"},
+			want: []string{"1.0.0", "1.0.0-rc.1", "1.0.0-alpha", "0.9.0"},
+		},
+		{
+			name: "build metadata decoded",
+			tags: []string{"1.0.0_build.1", "1.1.0"},
+			want: []string{"1.1.0", "1.0.0+build.1"},
+		},
+		{
+			name: "non-semantic tags skipped",
+			tags: []string{"latest", "v1.0.0", "1.0", "sha256-abc", "2.0.0"},
+			want: []string{"2.0.0"},
+		},
+		{
+			name: "empty",
+			tags: nil,
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sortTagVersions(tt.tags); !slices.Equal(got, tt.want) {
+				t.Errorf("sortTagVersions(%v) = %v, want %v", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package lock
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rrgmc/helm-vendor/internal/yaml"
+)
+
+// Lock records what was vendored for each chart, so the vendored tree can be checked and reproduced later.
+type Lock struct {
+	Charts []Chart `json:"charts"`
+}
+
+type Chart struct {
+	Path       string            `json:"path"`
+	Name       string            `json:"name"`
+	Version    string            `json:"version"`
+	Repository string            `json:"repository"`
+	Digest     string            `json:"digest,omitempty"`
+	SignedBy   string            `json:"signedBy,omitempty"`
+	Files      map[string]string `json:"files,omitempty"`
+}
+
+func (l *Lock) Get(path string) (Chart, bool) {
+	idx := slices.IndexFunc(l.Charts, func(c Chart) bool {
+		return c.Path == path
+	})
+	if idx < 0 {
+		return Chart{}, false
+	}
+	return l.Charts[idx], true
+}
+
+// Set adds or replaces the chart entry, keeping the list sorted by path.
+func (l *Lock) Set(chart Chart) {
+	idx := slices.IndexFunc(l.Charts, func(c Chart) bool {
+		return c.Path == chart.Path
+	})
+	if idx >= 0 {
+		l.Charts[idx] = chart
+	} else {
+		l.Charts = append(l.Charts, chart)
+	}
+	slices.SortFunc(l.Charts, func(a, b Chart) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+}
+
+func Load(r io.Reader) (*Lock, error) {
+	var lock Lock
+	if err := yaml.Decode(r, &lock); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// LoadFromFile loads the lock file, returning an empty lock if it does not exist.
+func LoadFromFile(path string) (*Lock, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Lock{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+func (l *Lock) Save(w io.Writer) error {
+	return yaml.Encode(w, l)
+}
+
+func (l *Lock) SaveToFile(path string) error {
+	var buf bytes.Buffer
+	if err := l.Save(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -23,3 +23,12 @@ func DecodeFile(root *os.Root, filename string, data any) error {
 	defer f.Close()
 	return Decode(f, data)
 }
+
+func Encode(w io.Writer, data any) error {
+	b, err := yaml.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
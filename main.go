@@ -5,16 +5,23 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
 
+	"github.com/rrgmc/helm-vendor/internal/cache"
 	"github.com/rrgmc/helm-vendor/internal/cmd"
+	"github.com/rrgmc/helm-vendor/internal/helm"
 	"github.com/urfave/cli/v3"
 )
 
 func main() {
-	ctx := context.Background()
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
 	if err := run(ctx); err != nil {
 		_, _ = fmt.Fprintf(os.Stderr, "%+v\n", err)
+		if errors.Is(err, cmd.ErrOutdated) {
+			os.Exit(2)
+		}
 		os.Exit(1)
 	}
 }
@@ -28,6 +35,33 @@ func run(ctx context.Context) error {
 				Aliases: []string{"c"},
 				Value:   "helm-vendor.yaml",
 			},
+			&cli.StringFlag{
+				Name:    "cache-dir",
+				Usage:   "folder to cache repository index files and chart archives (default: user cache folder)",
+				Sources: cli.EnvVars("HELM_VENDOR_CACHE_DIR"),
+			},
+			&cli.BoolFlag{
+				Name:  "no-cache",
+				Usage: "don't cache repository index files and chart archives",
+			},
+			&cli.BoolFlag{
+				Name:  "offline",
+				Usage: "use only repository index files and chart archives from the cache, never accessing the network",
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "output format of the info, outdated, download and dependency commands: table, json or yaml",
+				Value: string(cmd.OutputFormatTable),
+			},
+			&cli.BoolFlag{
+				Name:  "include-prerelease",
+				Usage: "allow pre-release versions to be used as the latest version for all charts",
+			},
+			&cli.IntFlag{
+				Name:  "concurrency",
+				Usage: "maximum number of charts processed concurrently when processing all charts",
+				Value: 4,
+			},
 		},
 		Commands: []*cli.Command{
 			{
@@ -93,8 +127,19 @@ func run(ctx context.Context) error {
 			{
 				Name:      "upgrade",
 				Usage:     "Upgrade a chart to a new version",
-				UsageText: "helm-vendor upgrade [options] path [version]",
+				UsageText: "helm-vendor upgrade [options] [path [version] | --all]",
 				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "all",
+						Aliases: []string{"a"},
+						Usage:   "upgrade all outdated charts",
+						Value:   false,
+					},
+					&cli.StringFlag{
+						Name:  "policy",
+						Usage: "version policy when no version is passed: latest, minor (same major version) or patch (same minor version)",
+						Value: string(cmd.VersionPolicyLatest),
+					},
 					&cli.BoolFlag{
 						Name:  "ignore-current",
 						Usage: "ignore current release (just unpack the new version over it)",
@@ -102,7 +147,7 @@ func run(ctx context.Context) error {
 					},
 					&cli.BoolFlag{
 						Name:  "apply-patch",
-						Usage: "create a diff of the local version and the chart of the same version, and patch the new version with it",
+						Usage: "merge the local changes into the new version, with a three-way merge of the chart of the local version, the local files and the new version",
 						Value: false,
 					},
 					&cli.StringFlag{
@@ -113,9 +158,24 @@ func run(ctx context.Context) error {
 						Name:  "current-chart-path",
 						Usage: "extract the current chart in this path instead of a temporary",
 					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "only print the upgrade plan, without changing any local file",
+						Value: false,
+					},
+					&cli.StringFlag{
+						Name:  "orphaned",
+						Usage: "what to do with files removed in the new version which have local changes: keep, move (to the .orphaned folder) or fail",
+						Value: string(cmd.OrphanPolicyMove),
+					},
+					&cli.StringFlag{
+						Name:  "binary",
+						Usage: "which copy of binary files with local changes to keep, as they can't be merged: local or upstream",
+						Value: string(cmd.BinaryPolicyUpstream),
+					},
 				},
 				Action: func(ctx context.Context, command *cli.Command) error {
-					if command.NArg() < 1 {
+					if !command.Bool("all") && command.NArg() < 1 {
 						return errors.New("path name is required")
 					}
 					var version string
@@ -123,14 +183,218 @@ func run(ctx context.Context) error {
 						version = command.Args().Get(1)
 					}
 
+					policy, err := cmd.ParseVersionPolicy(command.String("policy"))
+					if err != nil {
+						return err
+					}
+
+					orphaned, err := cmd.ParseOrphanPolicy(command.String("orphaned"))
+					if err != nil {
+						return err
+					}
+
+					binary, err := cmd.ParseBinaryPolicy(command.String("binary"))
+					if err != nil {
+						return err
+					}
+
+					c, err := newCmd(command)
+					if err != nil {
+						return err
+					}
+					defer c.Close()
+
+					options := cmd.UpgradeOptions{
+						IgnoreCurrent:          command.Bool("ignore-current"),
+						ApplyPatch:             command.Bool("apply-patch"),
+						DryRun:                 command.Bool("dry-run"),
+						LatestChartOutputPath:  command.String("latest-chart-path"),
+						CurrentChartOutputPath: command.String("current-chart-path"),
+						Policy:                 policy,
+						Orphaned:               orphaned,
+						Binary:                 binary,
+					}
+
+					if command.Bool("all") {
+						return c.UpgradeAll(ctx, options)
+					}
+
+					return c.Upgrade(ctx, command.Args().First(), version, options)
+				},
+			},
+			{
+				Name:      "outdated",
+				Usage:     "Check the vendored charts for newer versions. Exits with 2 if any chart can be upgraded, and 1 on errors",
+				UsageText: "helm-vendor outdated [options]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "policy",
+						Usage: "version policy: latest, minor (same major version) or patch (same minor version)",
+						Value: string(cmd.VersionPolicyLatest),
+					},
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					policy, err := cmd.ParseVersionPolicy(command.String("policy"))
+					if err != nil {
+						return err
+					}
+
+					c, err := newCmd(command)
+					if err != nil {
+						return err
+					}
+					defer c.Close()
+
+					return c.Outdated(ctx, policy)
+				},
+			},
+			{
+				Name:      "prefetch",
+				Usage:     "Cache the repository index files and chart archives needed to run offline",
+				UsageText: "helm-vendor prefetch [options] [path | --all]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "all",
+						Aliases: []string{"a"},
+						Usage:   "prefetch all charts",
+						Value:   false,
+					},
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					c, err := newCmd(command)
+					if err != nil {
+						return err
+					}
+					defer c.Close()
+
+					if command.Bool("all") {
+						return c.PrefetchAll(ctx)
+					}
+
+					if command.NArg() < 1 {
+						return errors.New("path name is required")
+					}
+
+					return c.Prefetch(ctx, command.Args().First())
+				},
+			},
+			{
+				Name:      "verify",
+				Usage:     "Verify that the vendored files match the upstream chart of the same version",
+				UsageText: "helm-vendor verify [options] [path | --all]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "all",
+						Aliases: []string{"a"},
+						Usage:   "verify all fetched charts",
+						Value:   false,
+					},
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					c, err := newCmd(command)
+					if err != nil {
+						return err
+					}
+					defer c.Close()
+
+					if command.Bool("all") {
+						return c.VerifyAll(ctx)
+					}
+
+					if command.NArg() < 1 {
+						return errors.New("path name is required")
+					}
+
+					return c.Verify(ctx, command.Args().First())
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "Show the local changes to a vendored chart, compared with the upstream chart of the same version",
+				UsageText: "helm-vendor diff [options] path",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "stat",
+						Usage: "show the number of lines added and deleted in each file instead of the diff",
+						Value: false,
+					},
+					&cli.BoolFlag{
+						Name:  "name-only",
+						Usage: "show only the names of the changed files",
+						Value: false,
+					},
+					&cli.BoolFlag{
+						Name:  "color",
+						Usage: "add terminal colors to the output",
+						Value: false,
+					},
+					&cli.StringFlag{
+						Name:  "output-file",
+						Usage: "write the output to this file instead of the standard output",
+					},
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
 					c, err := newCmd(command)
 					if err != nil {
 						return err
 					}
 					defer c.Close()
 
-					return c.Upgrade(ctx, command.Args().First(), version, command.Bool("ignore-current"), command.Bool("apply-patch"),
-						command.String("latest-chart-path"), command.String("current-chart-path"))
+					if command.NArg() < 1 {
+						return errors.New("path name is required")
+					}
+
+					return c.Diff(ctx, command.Args().First(), cmd.DiffOptions{
+						Stat:       command.Bool("stat"),
+						NameOnly:   command.Bool("name-only"),
+						Color:      command.Bool("color"),
+						OutputFile: command.String("output-file"),
+					})
+				},
+			},
+			{
+				Name:      "changes",
+				Usage:     "Show the upstream changes of a chart between two versions, by default from the local version to the latest",
+				UsageText: "helm-vendor changes [options] path [from] [to]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "summary",
+						Usage: "list the added, removed and changed files instead of the diff",
+						Value: false,
+					},
+					&cli.BoolFlag{
+						Name:  "color",
+						Usage: "add terminal colors to the diff",
+						Value: false,
+					},
+					&cli.StringFlag{
+						Name:  "policy",
+						Usage: "version policy when no to version is passed: latest, minor (same major version) or patch (same minor version)",
+						Value: string(cmd.VersionPolicyLatest),
+					},
+				},
+				Action: func(ctx context.Context, command *cli.Command) error {
+					policy, err := cmd.ParseVersionPolicy(command.String("policy"))
+					if err != nil {
+						return err
+					}
+
+					c, err := newCmd(command)
+					if err != nil {
+						return err
+					}
+					defer c.Close()
+
+					if command.NArg() < 1 {
+						return errors.New("path name is required")
+					}
+
+					return c.Changes(ctx, command.Args().Get(0), command.Args().Get(1), command.Args().Get(2),
+						cmd.ChangesOptions{
+							Summary: command.Bool("summary"),
+							Color:   command.Bool("color"),
+							Policy:  policy,
+						})
 				},
 			},
 			{
@@ -163,9 +427,17 @@ func run(ctx context.Context) error {
 					if command.NArg() > 2 {
 						version = command.Args().Get(2)
 					}
+					output, err := cmd.ParseOutputFormat(command.String("output"))
+					if err != nil {
+						return err
+					}
+					repositoryOptions, err := newRepositoryOptions(command)
+					if err != nil {
+						return err
+					}
 					return cmd.Download(ctx, command.Args().First(), command.Args().Get(1), version,
 						command.Bool("all-versions"), command.Bool("output-values-file"),
-						command.String("output-path"))
+						command.String("output-path"), output, repositoryOptions...)
 				},
 			},
 			{
@@ -204,9 +476,17 @@ func run(ctx context.Context) error {
 					if err != nil {
 						return err
 					}
+					output, err := cmd.ParseOutputFormat(command.String("output"))
+					if err != nil {
+						return err
+					}
+					repositoryOptions, err := newRepositoryOptions(command)
+					if err != nil {
+						return err
+					}
 					return cmd.Dependency(ctx, path, command.String("name"), command.String("version"),
 						command.Bool("all-versions"), command.Bool("output-values-file"),
-						command.String("output-path"))
+						command.String("output-path"), output, repositoryOptions...)
 				},
 			},
 			{
@@ -282,7 +562,69 @@ func newCmd(command *cli.Command, options ...cmd.Option) (*cmd.Cmd, error) {
 	}
 	outputRoot := filepath.Dir(cfgPath)
 
-	options = append(options, cmd.WithOutputRoot(outputRoot))
+	output, err := cmd.ParseOutputFormat(command.String("output"))
+	if err != nil {
+		return nil, err
+	}
+
+	options = append(options, cmd.WithOutputRoot(outputRoot), cmd.WithConcurrency(command.Int("concurrency")),
+		cmd.WithOutput(output))
+
+	if command.Bool("include-prerelease") {
+		options = append(options, cmd.WithIncludePrerelease())
+	}
+
+	if command.Bool("offline") {
+		options = append(options, cmd.WithOffline())
+	}
+
+	c, err := newCache(command)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		options = append(options, cmd.WithCache(c))
+	}
 
 	return cmd.NewFromFile(command.String("config-file"), options...)
 }
+
+// newRepositoryOptions returns the cache and offline repository options, for the commands which don't use the
+// configuration file.
+func newRepositoryOptions(command *cli.Command) ([]helm.RepositoryOption, error) {
+	var options []helm.RepositoryOption
+
+	if command.Bool("offline") {
+		options = append(options, helm.WithRepositoryOffline())
+	}
+
+	c, err := newCache(command)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		options = append(options, helm.WithRepositoryCache(c))
+	}
+
+	return options, nil
+}
+
+// newCache returns the cache set by the cache flags, or nil if caching is disabled.
+func newCache(command *cli.Command) (*cache.Cache, error) {
+	if command.Bool("no-cache") {
+		if command.Bool("offline") {
+			return nil, errors.New("--offline cannot be used with --no-cache")
+		}
+		return nil, nil
+	}
+
+	cacheDir := command.String("cache-dir")
+	if cacheDir == "" {
+		var err error
+		cacheDir, err = cache.DefaultPath()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cache path: %w", err)
+		}
+	}
+	return cache.New(cacheDir)
+}